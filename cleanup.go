@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// cleanupItem is something the clean up tab can remove for a manager: its
+// orphaned packages, through the Autoremove template, or its cache of
+// downloaded packages, through the CleanCache template.
+type cleanupItem struct {
+	Manager string   // Key in pm_commands
+	Kind    string   // "orphans" or "cache"
+	Names   []string // The orphans, or the cache directories
+	Listed  bool     // Names are known: flatpak only tells its unused runtimes when removing them
+	Size    int64    // Reclaimable bytes, -1 if unknown
+	Err     error
+}
+
+// cleanupLister finds what can be cleaned up for the managers using it.
+type cleanupLister struct {
+	managers  []string
+	key       string
+	orphans   func(ctx context.Context, r Runner) ([]string, int64, error) // nil if they can't be listed
+	cacheDirs func(ctx context.Context, r Runner) ([]string, error)
+}
+
+var cleanupListers = []cleanupLister{
+	{managers: []string{"apt", "dpkg", "dpkg-query"}, key: "apt", orphans: listAptOrphans, cacheDirs: fixedDirs("/var/cache/apt/archives")},
+	{managers: []string{"pacman"}, key: "pacman", orphans: listPacmanOrphans, cacheDirs: fixedDirs("/var/cache/pacman/pkg")},
+	{managers: []string{"dnf"}, key: "dnf", orphans: listDnfOrphans, cacheDirs: repoPackageDirs(2, "/var/cache/dnf", "/var/cache/libdnf5")},
+	{managers: []string{"yum"}, key: "yum", cacheDirs: repoPackageDirs(4, "/var/cache/yum")}, // yum/ARCH/RELEASE/REPO/packages
+	{managers: []string{"brew"}, key: "brew", orphans: listBrewOrphans, cacheDirs: brewCacheDirs},
+	{managers: []string{"flatpak"}, key: "flatpak"},
+	{managers: []string{"flatpak-user"}, key: "flatpak-user"},
+	{managers: []string{"nix-env"}, key: "nix-env", orphans: listNixDeadPaths},
+	{managers: []string{"nix-profile"}, key: "nix-profile", orphans: listNixDeadPaths},
+}
+
+func fixedDirs(dirs ...string) func(context.Context, Runner) ([]string, error) {
+	return func(context.Context, Runner) ([]string, error) { return dirs, nil }
+}
+
+// repoPackageDirs finds the "packages" directories of the repositories, at
+// depth under the caches of dnf and yum. `clean packages` only empties them,
+// and keeps the metadata next to them.
+func repoPackageDirs(depth int, caches ...string) func(context.Context, Runner) ([]string, error) {
+	return func(ctx context.Context, r Runner) ([]string, error) {
+		d := strconv.Itoa(depth)
+		args := append(slices.Clone(caches), "-mindepth", d, "-maxdepth", d, "-type", "d", "-name", "packages")
+		// find fails for the caches that don't exist, but lists the others
+		out, _ := r.Output(ctx, "find", args...)
+		return outputLines(out), nil
+	}
+}
+
+// listCleanup finds what can be cleaned up for every detected manager.
+func listCleanup(ctx context.Context, r Runner, pms []packageManager) []cleanupItem {
+	var items []cleanupItem
+	listed := make(map[int]bool, len(cleanupListers))
+	for _, p := range pms {
+		for i, l := range cleanupListers {
+			if listed[i] || !slices.Contains(l.managers, p.Name) {
+				continue
+			}
+			listed[i] = true
+			cmds := pm_commands[l.key]
+			if cmds.Autoremove != "" {
+				item := cleanupItem{Manager: l.key, Kind: "orphans", Size: -1}
+				if l.orphans != nil {
+					item.Names, item.Size, item.Err = l.orphans(ctx, r)
+					item.Listed = item.Err == nil
+				}
+				items = append(items, item)
+			}
+			if cmds.CleanCache != "" && l.cacheDirs != nil {
+				item := cleanupItem{Manager: l.key, Kind: "cache", Size: -1}
+				if item.Names, item.Err = l.cacheDirs(ctx, r); item.Err == nil {
+					item.Names, item.Size, item.Err = duSize(ctx, r, item.Names)
+					item.Listed = item.Err == nil
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// listAptOrphans lists the packages `apt-get -s autoremove` would remove,
+// with their installed size in KiB from dpkg-query.
+func listAptOrphans(ctx context.Context, r Runner) ([]string, int64, error) {
+	out, err := r.Output(ctx, "apt-get", "-s", "autoremove")
+	if err != nil {
+		return nil, -1, err
+	}
+	names := parseAptSimulation(out)
+	if len(names) == 0 {
+		return nil, 0, nil
+	}
+	args := append([]string{"-W", "-f", "${Installed-Size}\n"}, names...)
+	out, err = r.Output(ctx, "dpkg-query", args...)
+	if err != nil {
+		return names, -1, nil
+	}
+	var size int64
+	for _, line := range outputLines(out) {
+		if kib, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64); err == nil {
+			size += kib * 1024
+		}
+	}
+	return names, size, nil
+}
+
+// listPacmanOrphans lists the packages installed as dependencies that
+// nothing requires anymore, with their size from `pacman -Qi`.
+func listPacmanOrphans(ctx context.Context, r Runner) ([]string, int64, error) {
+	out, err := r.Output(ctx, "pacman", "-Qdtq")
+	if err != nil && len(out) == 0 {
+		return nil, 0, nil // pacman fails when there are no orphans
+	}
+	names := parseNameList(out)
+	out, err = r.Output(ctx, "env", append(pacmanInfoArgs, names...)...)
+	if err != nil {
+		return names, -1, nil
+	}
+	var size int64
+	for _, p := range parsePacmanInfo(out) {
+		size += p.Size
+	}
+	return names, size, nil
+}
+
+// listDnfOrphans lists the unneeded packages `dnf autoremove` removes, with
+// their installed size from rpm.
+func listDnfOrphans(ctx context.Context, r Runner) ([]string, int64, error) {
+	out, err := r.Output(ctx, "dnf", "repoquery", "--unneeded", "--queryformat", `%{name}\n`)
+	if err != nil {
+		return nil, -1, err
+	}
+	nodes := parseDepNames(out)
+	if len(nodes) == 0 {
+		return nil, 0, nil
+	}
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name
+	}
+	out, err = r.Output(ctx, "rpm", append([]string{"-q", "--queryformat", `%{SIZE}\n`}, names...)...)
+	if err != nil {
+		return names, -1, nil
+	}
+	var size int64
+	for _, line := range outputLines(out) {
+		if n, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64); err == nil {
+			size += n
+		}
+	}
+	return names, size, nil
+}
+
+// listBrewOrphans parses `brew autoremove --dry-run`: a "==> Would
+// autoremove" header, then a formula per line. Their size is that of their
+// directory in the Cellar.
+func listBrewOrphans(ctx context.Context, r Runner) ([]string, int64, error) {
+	out, err := r.Output(ctx, "brew", "autoremove", "--dry-run")
+	if err != nil {
+		return nil, -1, err
+	}
+	var names []string
+	for _, line := range outputLines(out) {
+		if !strings.HasPrefix(line, "==>") {
+			names = append(names, strings.TrimSpace(line))
+		}
+	}
+	if len(names) == 0 {
+		return nil, 0, nil
+	}
+	out, err = r.Output(ctx, "brew", "--cellar")
+	if err != nil {
+		return names, -1, nil
+	}
+	cellar := strings.TrimSpace(string(out))
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = cellar + "/" + name
+	}
+	_, size, _ := duSize(ctx, r, paths)
+	return names, size, nil
+}
+
+func brewCacheDirs(ctx context.Context, r Runner) ([]string, error) {
+	out, err := r.Output(ctx, "brew", "--cache")
+	if err != nil {
+		return nil, err
+	}
+	return []string{strings.TrimSpace(string(out))}, nil
+}
+
+// listNixDeadPaths lists the store paths nix-collect-garbage would delete.
+func listNixDeadPaths(ctx context.Context, r Runner) ([]string, int64, error) {
+	out, err := r.Output(ctx, "nix-store", "--gc", "--print-dead")
+	if err != nil {
+		return nil, -1, err
+	}
+	var names []string
+	for _, line := range outputLines(out) {
+		if strings.HasPrefix(line, "/nix/store/") {
+			names = append(names, storePathName(line))
+		}
+	}
+	return names, -1, nil
+}
+
+// describe tells what the item would remove, e.g. "3 orphaned packages".
+func (item cleanupItem) describe() string {
+	switch {
+	case item.Err != nil:
+		return "couldn't be listed: " + item.Err.Error()
+	case item.Kind == "cache":
+		return "downloaded packages in " + strings.Join(item.Names, ", ")
+	case !item.Listed:
+		return "unused runtimes and packages, listed when removing them"
+	case strings.HasPrefix(item.Manager, "nix"):
+		return plural(len(item.Names), "unreachable store path")
+	}
+	return plural(len(item.Names), "orphaned package") + ": " + strings.Join(item.Names, ", ")
+}
+
+func (item cleanupItem) size() string {
+	if item.Size < 0 {
+		return "?"
+	}
+	return humanSize(item.Size)
+}
+
+// empty tells whether there is known to be nothing to clean up.
+func (item cleanupItem) empty() bool {
+	if item.Kind == "cache" {
+		return item.Listed && item.Size == 0
+	}
+	return item.Listed && len(item.Names) == 0
+}
+
+// cleanupMsg carries what the clean up tab can remove.
+type cleanupMsg struct {
+	items []cleanupItem
+}
+
+func loadCleanup(r Runner, pms []packageManager) tea.Cmd {
+	return func() tea.Msg {
+		return cleanupMsg{items: listCleanup(context.Background(), r, pms)}
+	}
+}
+
+func (msg cleanupMsg) status() string {
+	var total int64
+	var sizes []string
+	for _, item := range msg.items {
+		if item.Size > 0 {
+			total += item.Size
+			sizes = append(sizes, item.Manager+" "+item.Kind+" "+humanSize(item.Size))
+		}
+	}
+	if len(sizes) == 0 {
+		return "Nothing known to be reclaimable"
+	}
+	return "Reclaimable: " + humanSize(total) + " (" + strings.Join(sizes, ", ") + ")"
+}
+
+// cleanupJob removes the orphans or empties the cache of an item.
+func cleanupJob(r Runner, item cleanupItem) tea.Cmd {
+	cmds := pm_commands[item.Manager]
+	if item.Kind == "cache" {
+		return runJob(r, "clean the cache of", cmds.CleanCache, Package{Name: item.Manager, Manager: item.Manager}, "")
+	}
+	return runJob(r, "remove the orphans of", cmds.Autoremove, Package{Name: item.Manager, Manager: item.Manager}, strings.Join(item.Names, " "))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestListCleanup(t *testing.T) {
+	r := fixtureRunner{dir: "testdata/fixtures/ubuntu"}
+	items := listCleanup(context.Background(), r, detectPM(r))
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Manager+" "+item.Kind+" "+item.size()+": "+item.describe())
+	}
+	want := []string{
+		// Sizes from dpkg-query, in KiB
+		"apt orphans 197.2 MiB: 2 orphaned packages: libllvm17t64, linux-headers-6.8.0-45",
+		// du can't read partial/ but still sizes the rest
+		"apt cache 245.4 MiB: downloaded packages in /var/cache/apt/archives",
+		"flatpak orphans ?: unused runtimes and packages, listed when removing them",
+		"flatpak-user orphans ?: unused runtimes and packages, listed when removing them",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("items:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got, want := (cleanupMsg{items}).status(), "Reclaimable: 442.6 MiB (apt orphans 197.2 MiB, apt cache 245.4 MiB)"; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
+
+// Only the downloaded packages count, not the metadata of the repositories.
+func TestListCleanupDnfCache(t *testing.T) {
+	r := fixtureRunner{dir: "testdata/fixtures/fedora"}
+	for _, item := range listCleanup(context.Background(), r, detectPM(r)) {
+		if item.Manager != "dnf" || item.Kind != "cache" {
+			continue
+		}
+		want := []string{"/var/cache/libdnf5/fedora-2d6b37a2e5dbe3e2/packages", "/var/cache/libdnf5/updates-53d1bdf7c1bb1b1b/packages"}
+		if !slices.Equal(item.Names, want) || item.Size != (18432+40960)*1024 {
+			t.Errorf("cache = %q, %d bytes, want %q", item.Names, item.Size, want)
+		}
+		return
+	}
+	t.Error("no dnf cache listed")
+}
+
+func TestCleanupItemEmpty(t *testing.T) {
+	tests := []struct {
+		item cleanupItem
+		want bool
+	}{
+		{cleanupItem{Kind: "orphans", Listed: true}, true},
+		{cleanupItem{Kind: "orphans", Listed: true, Names: []string{"libfoo"}, Size: -1}, false},
+		{cleanupItem{Kind: "orphans", Size: -1}, false}, // flatpak, which doesn't tell
+		{cleanupItem{Kind: "cache", Listed: true, Names: []string{"/var/cache/apt/archives"}}, true},
+		{cleanupItem{Kind: "cache", Listed: true, Names: []string{"/var/cache/apt/archives"}, Size: 4096}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.item.empty(); got != tt.want {
+			t.Errorf("%+v: empty = %v, want %v", tt.item, got, tt.want)
+		}
+	}
+	if got := (cleanupMsg{}).status(); got != "Nothing known to be reclaimable" {
+		t.Errorf("status = %q", got)
+	}
+}
+
+// Removing the orphans waits for a confirmation.
+func TestUpdateCleanup(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	m := fixtureModel(t, "ubuntu")
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyCtrlL})
+	if cmd == nil {
+		t.Fatal("Ctrl+L didn't list what to clean up")
+	}
+	m, _ = update(m, cmd())
+	if len(m.cleanup) == 0 {
+		t.Fatalf("nothing to clean up: %s", m.status)
+	}
+
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || m.confirm == nil {
+		t.Fatal("Enter didn't ask for a confirmation")
+	}
+	if want := "apt: 2 orphaned packages: libllvm17t64, linux-headers-6.8.0-45 (197.2 MiB). Press Enter to remove them, any other key to cancel"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if cmd != nil || m.confirm != nil || m.status != "Cancelled" {
+		t.Fatalf("after cancelling: command %v, confirm set %v, status %q", cmd != nil, m.confirm != nil, m.status)
+	}
+
+	m, _ = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("Enter didn't confirm")
+	}
+	m, _ = update(m, cmd())
+	if want := "[dry-run] sudo apt autoremove"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// column is a column of the package list.
+type column struct {
+	ID         string // Saved in layout.json
+	Title      string
+	value      func(Package) string
+	compare    func(a, b Package) int
+	minWidth   int  // Narrowest it gets when the list doesn't fit
+	right      bool // Aligned right, e.g. sizes
+	descending bool // Sorted the other way first, e.g. the largest packages
+}
+
+var columns = []column{
+	{
+		ID: "name", Title: "Name", minWidth: 10,
+		value:   func(p Package) string { return p.Name },
+		compare: func(a, b Package) int { return naturalCompare(a.Name, b.Name) },
+	},
+	{
+		ID: "manager", Title: "Manager", minWidth: 6,
+		value:   packageManagerLabel,
+		compare: func(a, b Package) int { return cmp.Compare(packageManagerLabel(a), packageManagerLabel(b)) },
+	},
+	{
+		ID: "version", Title: "Version", minWidth: 10,
+		value:   func(p Package) string { return p.Version },
+		compare: func(a, b Package) int { return naturalCompare(a.Version, b.Version) },
+	},
+	{
+		ID: "size", Title: "Size", minWidth: 9, right: true, descending: true,
+		value:   packageSize,
+		compare: func(a, b Package) int { return cmp.Compare(a.Size, b.Size) },
+	},
+	{
+		ID: "status", Title: "Status", minWidth: 11,
+		value:   packageStatus,
+		compare: func(a, b Package) int { return cmp.Compare(packageStatus(a), packageStatus(b)) },
+	},
+	{
+		ID: "upgrade", Title: "Upgrade", minWidth: 10,
+		value:   func(p Package) string { return p.Upgrade },
+		compare: func(a, b Package) int { return naturalCompare(a.Upgrade, b.Upgrade) },
+	},
+}
+
+// packageManagerLabel is the manager of a package, with the remote or
+// repository it came from.
+func packageManagerLabel(p Package) string {
+	if p.Origin != "" {
+		return p.Manager + " (" + p.Origin + ")"
+	}
+	return p.Manager
+}
+
+func packageStatus(p Package) string {
+	switch {
+	case !p.IsInstalled:
+		return "install ↓"
+	case p.OwnHold:
+		return "held ⏸ (lazyinstaller only)"
+	case p.Held:
+		return "held ⏸"
+	case p.Upgrade != "":
+		return "upgradable ↑"
+	}
+	return "installed ✓"
+}
+
+func findColumn(id string) (column, bool) {
+	for _, c := range columns {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// naturalCompare compares strings ignoring case, and runs of digits by their
+// value, so "python3.9" comes before "python3.12".
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+		if unicode.IsDigit(ra) && unicode.IsDigit(rb) {
+			na, nb := leadingDigits(a), leadingDigits(b)
+			x, y := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if c := cmp.Or(cmp.Compare(len(x), len(y)), cmp.Compare(x, y)); c != 0 {
+				return c
+			}
+			a, b = a[len(na):], b[len(nb):]
+			continue
+		}
+		if c := cmp.Compare(unicode.ToLower(ra), unicode.ToLower(rb)); c != 0 {
+			return c
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func leadingDigits(s string) string {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i < 0 {
+		return s
+	}
+	return s[:i]
+}
+
+// listLayout is how the package list is shown: its columns, in order, and
+// the column it's sorted by. It's kept in layout.json in the config
+// directory.
+type listLayout struct {
+	Columns    []string `json:"columns"`
+	SortBy     string   `json:"sort_by,omitempty"` // Empty lists packages in the order they were found
+	Descending bool     `json:"descending,omitempty"`
+}
+
+func defaultLayout() listLayout {
+	return listLayout{Columns: []string{"name", "manager", "version", "size", "status"}}
+}
+
+// loadLayout reads layout.json, ignoring the columns it doesn't know.
+func loadLayout() (listLayout, error) {
+	layout := defaultLayout()
+	path, err := configPath("layout.json")
+	if err != nil {
+		return layout, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return layout, nil
+	}
+	if err != nil {
+		return layout, err
+	}
+	var saved listLayout
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return layout, fmt.Errorf("%s: %w", path, err)
+	}
+	saved.Columns = slices.DeleteFunc(saved.Columns, func(id string) bool {
+		_, ok := findColumn(id)
+		return !ok
+	})
+	if len(saved.Columns) == 0 {
+		saved.Columns = layout.Columns
+	}
+	if _, ok := findColumn(saved.SortBy); !ok {
+		saved.SortBy, saved.Descending = "", false
+	}
+	return saved, nil
+}
+
+func (l listLayout) save() error {
+	path, err := configPath("layout.json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// shown returns the columns to show, in order.
+func (l listLayout) shown() []column {
+	cols := make([]column, 0, len(l.Columns))
+	for _, id := range l.Columns {
+		if c, ok := findColumn(id); ok {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// sort returns the packages in the chosen order, leaving pkgs as is.
+func (l listLayout) sort(pkgs []Package) []Package {
+	c, ok := findColumn(l.SortBy)
+	if !ok {
+		return pkgs
+	}
+	sorted := slices.Clone(pkgs)
+	slices.SortStableFunc(sorted, func(a, b Package) int {
+		if l.Descending {
+			return c.compare(b, a)
+		}
+		return c.compare(a, b)
+	})
+	return sorted
+}
+
+// nextSort sorts by the next shown column, after the last one going back to
+// the order packages were found in.
+func (l *listLayout) nextSort() {
+	i := slices.Index(l.Columns, l.SortBy)
+	if i+1 >= len(l.Columns) {
+		l.SortBy, l.Descending = "", false
+		return
+	}
+	l.SortBy = l.Columns[i+1]
+	c, _ := findColumn(l.SortBy)
+	l.Descending = c.descending
+}
+
+func (l listLayout) sortStatus() string {
+	c, ok := findColumn(l.SortBy)
+	switch {
+	case !ok:
+		return "Packages in the order they were found"
+	case l.Descending:
+		return "Sorted by " + strings.ToLower(c.Title) + ", descending"
+	}
+	return "Sorted by " + strings.ToLower(c.Title) + ", ascending"
+}
+
+// toggle shows or hides a column; the last one shown stays.
+func (l *listLayout) toggle(id string) {
+	if i := slices.Index(l.Columns, id); i >= 0 {
+		if len(l.Columns) > 1 {
+			l.Columns = slices.Delete(slices.Clone(l.Columns), i, i+1)
+		}
+		return
+	}
+	l.Columns = append(slices.Clone(l.Columns), id)
+}
+
+// move moves a shown column left (-1) or right (+1).
+func (l *listLayout) move(id string, delta int) {
+	i := slices.Index(l.Columns, id)
+	j := i + delta
+	if i < 0 || j < 0 || j >= len(l.Columns) {
+		return
+	}
+	l.Columns = slices.Clone(l.Columns)
+	l.Columns[i], l.Columns[j] = l.Columns[j], l.Columns[i]
+}
+
+// title is the header of a column, with an arrow if the list is sorted by it.
+func (l listLayout) title(c column) string {
+	switch {
+	case c.ID != l.SortBy:
+		return c.Title
+	case l.Descending:
+		return c.Title + " ▼"
+	}
+	return c.Title + " ▲"
+}
+
+// columnWidths fits the columns to their content, then narrows the widest
+// until a row fits in width.
+func (l listLayout) columnWidths(cols []column, pkgs []Package, width int) []int {
+	widths := make([]int, len(cols))
+	for i, c := range cols {
+		widths[i] = ansi.StringWidth(l.title(c))
+		for _, p := range pkgs {
+			widths[i] = max(widths[i], ansi.StringWidth(c.value(p)))
+		}
+	}
+	excess := len(cols) - 1 - width // Columns are separated by a space
+	for _, w := range widths {
+		excess += w
+	}
+	for ; excess > 0; excess-- {
+		widest := -1
+		for i, w := range widths {
+			if w > cols[i].minWidth && (widest < 0 || w > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+// formatRow lays out the cells of a row in the columns.
+func formatRow(cols []column, widths []int, cells []string) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		cell := truncate(cells[i], widths[i])
+		switch {
+		case c.right:
+			parts[i] = padLeft(cell, widths[i])
+		case i < len(cols)-1:
+			parts[i] = padRight(cell, widths[i])
+		default:
+			parts[i] = cell
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// columnPicker is shown over the list to choose the columns.
+type columnPicker struct {
+	cursor int
+}
+
+// ids lists the shown columns first, in order, then the hidden ones.
+func (p columnPicker) ids(l listLayout) []string {
+	ids := slices.Clone(l.Columns)
+	for _, c := range columns {
+		if !slices.Contains(ids, c.ID) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
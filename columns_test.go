@@ -0,0 +1,234 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hell…"},
+		{"abc", 2, "ab"}, // Too narrow for an ellipsis
+		// CJK characters take 2 cells and are never cut in half
+		{"日本語パッケージ", 7, "日本語…"},
+		{"日本語パッケージ", 6, "日本…"},
+		{"📦 box-tools", 4, "📦 …"},
+		{"📦 box-tools", 2, "📦"},
+		// A combining accent stays with its letter
+		{"cafe\u0301", 4, "cafe\u0301"},
+		{"cafe\u0301 au lait", 5, "cafe\u0301…"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if w := ansi.StringWidth(got); w > tt.width {
+			t.Errorf("truncate(%q, %d) is %d cells wide", tt.s, tt.width, w)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s           string
+		width       int
+		right, left string
+	}{
+		{"ab", 4, "ab  ", "  ab"},
+		{"日本", 6, "日本  ", "  日本"},
+		{"📦", 3, "📦 ", " 📦"},
+		{"cafe\u0301", 6, "cafe\u0301  ", "  cafe\u0301"},
+		{"toolong", 3, "toolong", "toolong"}, // Never cut
+	}
+	for _, tt := range tests {
+		if got := padRight(tt.s, tt.width); got != tt.right {
+			t.Errorf("padRight(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.right)
+		}
+		if got := padLeft(tt.s, tt.width); got != tt.left {
+			t.Errorf("padLeft(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.left)
+		}
+	}
+}
+
+func TestColumnWidths(t *testing.T) {
+	l := defaultLayout() // Name, Manager, Version, Size, Status
+	cols := l.shown()
+	pkgs := []Package{
+		{Name: "libreoffice-l10n-zh-cn-very-long-name", Manager: "apt/dpkg", Version: "4:24.2.7-0ubuntu0.24.04.1", Size: 123456789, IsInstalled: true},
+		{Name: "日本語入力", Manager: "flatpak", Origin: "flathub", Version: "1.0", IsInstalled: true},
+		{Name: "📦-tools", Manager: "snap", Version: "2.0", Held: true, IsInstalled: true},
+	}
+	minWidths := []int{10, 6, 10, 9, 11}
+
+	tests := []struct {
+		width int
+		want  []int
+	}{
+		// Wide enough: each column fits its widest cell
+		{200, []int{37, 17, 25, 9, 11}},
+		// The widest columns give way first
+		{80, []int{19, 17, 20, 9, 11}},
+		// Too narrow: every column shrinks to its minimum, and no further
+		{40, minWidths},
+		{10, minWidths},
+	}
+	for _, tt := range tests {
+		widths := l.columnWidths(cols, pkgs, tt.width)
+		if !slices.Equal(widths, tt.want) {
+			t.Errorf("width %d: widths = %v, want %v", tt.width, widths, tt.want)
+		}
+
+		// The columns of every row, header included, line up: a "|" in the
+		// last column starts at the same cell
+		rows := []string{formatRow(cols, widths, []string{"Name", "Manager", "Version", "Size", "|"})}
+		for _, p := range pkgs {
+			cells := make([]string, len(cols))
+			for i, c := range cols[:len(cols)-1] {
+				cells[i] = c.value(p)
+			}
+			cells[len(cells)-1] = "|"
+			rows = append(rows, formatRow(cols, widths, cells))
+		}
+		want := sum(widths[:len(widths)-1]) + len(widths)
+		for _, row := range rows {
+			if w := ansi.StringWidth(row); w != want {
+				t.Errorf("width %d: row %q is %d cells wide, want %d", tt.width, row, w, want)
+			}
+		}
+	}
+}
+
+func sum(widths []int) int {
+	n := 0
+	for _, w := range widths {
+		n += w
+	}
+	return n
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"python3.9", "python3.12", -1},
+		{"python3.12", "python3.9", 1},
+		{"Python3.12", "python3.12", 0}, // Case is ignored
+		{"lib2", "lib02", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1:2.2.1-1", "1:2.2.1-10", -1},
+		{"gcc", "gcc-c++", -1},
+		{"zlib", "Zsh", -1},
+		{"日本2", "日本10", -1},
+	}
+	for _, tt := range tests {
+		if got := naturalCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Ctrl+S sorts by each shown column in turn, sizes the largest first, then
+// goes back to the order packages were found in; Ctrl+R reverses it.
+func TestLayoutSort(t *testing.T) {
+	pkgs := []Package{
+		{Name: "python3.12", Version: "3.12.2", Size: 100},
+		{Name: "Python3.9", Version: "3.9.18", Size: 300},
+		{Name: "python3.10", Version: "3.10.13"},
+	}
+	l := defaultLayout()
+	tests := []struct {
+		status string
+		names  []string
+	}{
+		{"Sorted by name, ascending", []string{"Python3.9", "python3.10", "python3.12"}},
+		{"Sorted by manager, ascending", []string{"python3.12", "Python3.9", "python3.10"}}, // Stable
+		{"Sorted by version, ascending", []string{"Python3.9", "python3.10", "python3.12"}},
+		{"Sorted by size, descending", []string{"Python3.9", "python3.12", "python3.10"}},
+		{"Sorted by status, ascending", []string{"python3.12", "Python3.9", "python3.10"}},
+		{"Packages in the order they were found", []string{"python3.12", "Python3.9", "python3.10"}},
+	}
+	for _, tt := range tests {
+		l.nextSort()
+		if got := l.sortStatus(); got != tt.status {
+			t.Fatalf("status = %q, want %q", got, tt.status)
+		}
+		if got := names(l.sort(pkgs)); !slices.Equal(got, tt.names) {
+			t.Errorf("%s: %q, want %q", tt.status, got, tt.names)
+		}
+	}
+
+	l.nextSort()
+	l.Descending = !l.Descending
+	if got, want := names(l.sort(pkgs)), []string{"python3.12", "python3.10", "Python3.9"}; !slices.Equal(got, want) || l.sortStatus() != "Sorted by name, descending" {
+		t.Errorf("reversed: %q (%s), want %q", got, l.sortStatus(), want)
+	}
+	if got := names(pkgs); got[0] != "python3.12" {
+		t.Errorf("sorting changed the packages: %q", got)
+	}
+}
+
+func names(pkgs []Package) []string {
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestLayoutColumns(t *testing.T) {
+	l := defaultLayout()
+	l.toggle("size")
+	l.toggle("upgrade")
+	l.move("upgrade", -1)
+	l.move("name", -1) // Already first
+	if want := []string{"name", "manager", "version", "upgrade", "status"}; !slices.Equal(l.Columns, want) {
+		t.Errorf("columns = %q, want %q", l.Columns, want)
+	}
+	if def := defaultLayout(); !slices.Contains(def.Columns, "size") {
+		t.Error("changing a layout changed the default one")
+	}
+
+	l = listLayout{Columns: []string{"name"}}
+	l.toggle("name")
+	if !slices.Equal(l.Columns, []string{"name"}) {
+		t.Errorf("the last column was hidden: %q", l.Columns)
+	}
+}
+
+func TestLayoutSaveLoad(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	if l, err := loadLayout(); err != nil || !slices.Equal(l.Columns, defaultLayout().Columns) {
+		t.Fatalf("without layout.json: %+v, %v", l, err)
+	}
+
+	saved := listLayout{Columns: []string{"size", "name", "upgrade"}, SortBy: "size", Descending: true}
+	if err := saved.save(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loadLayout()
+	if err != nil || !slices.Equal(l.Columns, saved.Columns) || l.SortBy != saved.SortBy || l.Descending != saved.Descending {
+		t.Errorf("loaded %+v, %v, want %+v", l, err, saved)
+	}
+
+	// Columns of another version are left out
+	path := filepath.Join(config, "lazyinstaller", "layout.json")
+	if err := os.WriteFile(path, []byte(`{"columns": ["license", "name"], "sort_by": "license", "descending": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = loadLayout()
+	if err != nil || !slices.Equal(l.Columns, []string{"name"}) || l.SortBy != "" || l.Descending {
+		t.Errorf("loaded %+v, %v, want the name column, unsorted", l, err)
+	}
+}
@@ -10,6 +10,11 @@ type commands struct {
 	UpgradeAll    string
 	ListInstalled string
 	UpdateIndex   string
+	Hold          string // keep the package at its version when upgrading
+	Unhold        string
+	InstallFile   string // install a local package file, x is its absolute path
+	Autoremove    string // remove orphaned packages, x is the orphans if it needs them
+	CleanCache    string // empty the cache of downloaded packages
 }
 
 var pm_commands = map[string]commands{
@@ -33,6 +38,11 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "sudo apt upgrade",
 		ListInstalled: "apt list --installed", // apt list -i
 		UpdateIndex:   "sudo apt update",
+		Hold:          "sudo apt-mark hold x",
+		Unhold:        "sudo apt-mark unhold x",
+		InstallFile:   "sudo apt install x",
+		Autoremove:    "sudo apt autoremove",
+		CleanCache:    "sudo apt clean",
 	},
 	"brew": { // no need for sudo AT ALL
 		Name:          "brew",
@@ -44,6 +54,10 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "brew upgrade",
 		ListInstalled: "brew list",
 		UpdateIndex:   "brew update",
+		Hold:          "brew pin x",
+		Unhold:        "brew unpin x",
+		Autoremove:    "brew autoremove",
+		CleanCache:    "brew cleanup --prune=all",
 	},
 	"port": { // needs sudo for install, remove, upgrade, update
 		Name:          "port",
@@ -55,25 +69,46 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "sudo port upgrade",
 		ListInstalled: "port installed",
 	},
-	"flatpak": { // if system-wide, need sudo for install, remove, upgrade, update
+	"flatpak": { // system-wide installation, need sudo for install, remove, upgrade, update
 		Name:          "flatpak",
-		Install:       "sudo flatpak install x",
-		Uninstall:     "sudo flatpak uninstall x",
-		Upgrade:       "sudo flatpak update x",
+		Install:       "sudo flatpak install --system x",
+		Uninstall:     "sudo flatpak uninstall --system x",
+		Upgrade:       "sudo flatpak update --system x",
 		Search:        "flatpak search x",
-		Info:          "flatpak info x",
-		UpgradeAll:    "sudo flatpak update",
-		ListInstalled: "flatpak list --app", // added --app to show apps only
+		Info:          "flatpak info --system x",
+		UpgradeAll:    "sudo flatpak update --system",
+		ListInstalled: "flatpak list --system --app", // added --app to show apps only
+		Hold:          "sudo flatpak mask --system x",
+		Unhold:        "sudo flatpak mask --system --remove x",
+		InstallFile:   "sudo flatpak install --system --from x",
+		Autoremove:    "sudo flatpak uninstall --unused --system",
+	},
+	"flatpak-user": { // per-user installation in ~/.local/share/flatpak, no sudo
+		Name:          "flatpak-user",
+		Install:       "flatpak install --user x",
+		Uninstall:     "flatpak uninstall --user x",
+		Upgrade:       "flatpak update --user x",
+		Search:        "flatpak search x",
+		Info:          "flatpak info --user x",
+		UpgradeAll:    "flatpak update --user",
+		ListInstalled: "flatpak list --user --app",
+		Hold:          "flatpak mask --user x",
+		Unhold:        "flatpak mask --user --remove x",
+		InstallFile:   "flatpak install --user --from x",
+		Autoremove:    "flatpak uninstall --unused --user",
 	},
 	"snap": { // need sudo for install, remove, upgrade, update
 		Name:          "snap",
-		Install:       "sudo snap install --classic x", // --classic or not ?
+		Install:       "sudo snap install x", // --classic is added for snaps that need it, see snapConfinementFlag
 		Uninstall:     "sudo snap remove x",
 		Upgrade:       "sudo snap refresh x",
 		Search:        "snap find x",
 		Info:          "snap info x",
 		UpgradeAll:    "sudo snap refresh",
 		ListInstalled: "snap list",
+		Hold:          "sudo snap refresh --hold x",
+		Unhold:        "sudo snap refresh --unhold x",
+		InstallFile:   "sudo snap install x",
 	},
 	"dnf": { // need sudo for install, remove, upgrade, update
 		Name:          "dnf",
@@ -84,7 +119,12 @@ var pm_commands = map[string]commands{
 		Info:          "dnf info x",
 		UpgradeAll:    "sudo dnf upgrade -y",
 		ListInstalled: "dnf list installed",
-		UpdateIndex:   "dnf check-update",
+		UpdateIndex:   "sudo dnf makecache", // Not check-update, which exits with 100 when there are updates
+		Hold:          "sudo dnf versionlock add x",
+		Unhold:        "sudo dnf versionlock delete x",
+		InstallFile:   "sudo dnf install -y x",
+		Autoremove:    "sudo dnf autoremove",
+		CleanCache:    "sudo dnf clean packages",
 	},
 	"rpm": { // need sudo for install, remove, upgrade, update
 		Name:          "rpm",
@@ -95,6 +135,7 @@ var pm_commands = map[string]commands{
 		Info:          "rpm -q x",
 		UpgradeAll:    "sudo rpm -Uvh x",
 		ListInstalled: "rpm -qa",
+		InstallFile:   "sudo rpm -i x",
 	},
 	"pacman": { // need sudo for install, remove, upgrade, update
 		Name:          "pacman",
@@ -106,6 +147,9 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "sudo pacman -Syu --noconfirm",
 		ListInstalled: "pacman -Q",
 		UpdateIndex:   "sudo pacman -Sy",
+		InstallFile:   "sudo pacman -U --noconfirm x",
+		Autoremove:    "sudo pacman -Rns x",
+		CleanCache:    "sudo pacman -Scc",
 	},
 	"yum": { // need sudo for install, remove, upgrade, update
 		Name:          "yum",
@@ -117,6 +161,11 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "sudo yum update -y",
 		ListInstalled: "yum list installed",
 		UpdateIndex:   "sudo yum makecache",
+		Hold:          "sudo yum versionlock add x",
+		Unhold:        "sudo yum versionlock delete x",
+		InstallFile:   "sudo yum install -y x",
+		Autoremove:    "sudo yum autoremove",
+		CleanCache:    "sudo yum clean packages",
 	},
 	"zypper": { // needs sudo for install, remove, upgrade, update
 		Name:          "zypper",
@@ -128,6 +177,7 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "sudo zypper update -n",
 		ListInstalled: "zypper se --installed-only",
 		UpdateIndex:   "sudo zypper refresh",
+		InstallFile:   "sudo zypper install -n x",
 	},
 	"apk": { // needs sudo for install, remove, upgrade, update
 		Name:          "apk",
@@ -172,6 +222,18 @@ var pm_commands = map[string]commands{
 		UpgradeAll:    "nix-env -u",
 		ListInstalled: "nix-env -q",
 		UpdateIndex:   "nix-channel --update", // or nix-env -u without args? usually channel update is needed
+		Autoremove:    "nix-collect-garbage",
+	},
+	"nix-profile": { // no need for sudo
+		Name:          "nix-profile",
+		Install:       "nix profile install nixpkgs#x",
+		Uninstall:     "nix profile remove x",
+		Upgrade:       "nix profile upgrade x",
+		Search:        "nix search nixpkgs x",
+		Info:          "nix eval --json nixpkgs#x.meta",
+		UpgradeAll:    "nix profile upgrade --all",
+		ListInstalled: "nix profile list",
+		Autoremove:    "nix-collect-garbage",
 	},
 	"pkg": { // needs sudo for install, remove, upgrade, update
 		Name:          "pkg",
@@ -294,3 +356,95 @@ var pm_commands = map[string]commands{
 		ListInstalled: "cards list",
 	},
 }
+
+// repoCommands manage the repositories (sources, remotes, taps, channels) of
+// a package manager. "x" is the repository, as listed in the repositories tab.
+type repoCommands struct {
+	Add     string
+	Remove  string
+	Enable  string
+	Disable string
+}
+
+var repo_commands = map[string]repoCommands{
+	"apt": { // x is a PPA (ppa:user/name) or a one-line source ("deb URL suite components")
+		Add:    "sudo add-apt-repository -y x",
+		Remove: "sudo add-apt-repository --remove -y x",
+	},
+	"dnf": { // dnf4 syntax, see dnf5RepoCommands
+		Add:     "sudo dnf config-manager --add-repo x",
+		Enable:  "sudo dnf config-manager --set-enabled x",
+		Disable: "sudo dnf config-manager --set-disabled x",
+	},
+	"flatpak": { // x to add is "NAME URL"
+		Add:     "sudo flatpak remote-add --system --if-not-exists x",
+		Remove:  "sudo flatpak remote-delete --system x",
+		Enable:  "sudo flatpak remote-modify --system --enable x",
+		Disable: "sudo flatpak remote-modify --system --disable x",
+	},
+	"flatpak-user": {
+		Add:     "flatpak remote-add --user --if-not-exists x",
+		Remove:  "flatpak remote-delete --user x",
+		Enable:  "flatpak remote-modify --user --enable x",
+		Disable: "flatpak remote-modify --user --disable x",
+	},
+	"brew": {
+		Add:    "brew tap x",
+		Remove: "brew untap x",
+	},
+	"nix-env": { // x to add is "URL [NAME]"
+		Add:    "nix-channel --add x",
+		Remove: "nix-channel --remove x",
+	},
+	"nix-profile": { // flake registry, x to add is "NAME FLAKEREF"
+		Add:    "nix registry add x",
+		Remove: "nix registry remove x",
+	},
+	// guix channels are only configured in ~/.config/guix/channels.scm
+}
+
+// dnf5RepoCommands replace those of dnf when it's dnf5, whose config-manager
+// sets repo options instead: x is "REPO.enabled=1" to enable and
+// "REPO.enabled=0" to disable.
+var dnf5RepoCommands = repoCommands{
+	Add:     "sudo dnf config-manager addrepo --from-repofile x",
+	Enable:  "sudo dnf config-manager setopt x",
+	Disable: "sudo dnf config-manager setopt x",
+}
+
+// managerKey maps the manager label shown in the package list
+// (e.g. "apt/dpkg") to its key in pm_commands (e.g. "apt").
+func managerKey(manager string) string {
+	switch manager {
+	case "apt/dpkg", "dpkg", "dpkg-query":
+		return "apt"
+	case "rpm/dnf":
+		return "dnf"
+	case "macports":
+		return "port"
+	case "nix-user":
+		return "nix-env"
+	case "nix":
+		return "nix-profile"
+	case "xbps-install":
+		return "xbps"
+	}
+	return manager
+}
+
+// versionedName returns the package spec that asks the manager for a
+// specific version, or false if the manager can't install one by name.
+func versionedName(manager, name, version string) (string, bool) {
+	if version == "" {
+		return name, true
+	}
+	switch managerKey(manager) {
+	case "apt", "apk", "zypper":
+		return name + "=" + version, true
+	case "dnf", "yum":
+		return name + "-" + version, true
+	case "brew":
+		return name + "@" + version, true
+	}
+	return "", false
+}
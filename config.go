@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// configPath returns the path of a file in the lazyinstaller config
+// directory, e.g. ~/.config/lazyinstaller/<name> on Linux.
+func configPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lazyinstaller", name), nil
+}
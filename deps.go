@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// depNode is a package in a dependency tree. Most managers only tell the
+// direct dependencies of a package, so trees are loaded a level at a time as
+// their nodes are expanded; brew and Nix print the whole tree at once.
+type depNode struct {
+	Name     string
+	ID       string // What the manager is asked about: the name, or the store path for Nix
+	Children []*depNode
+	Loaded   bool // Children are known
+	Expanded bool
+	Repeated bool // Already expanded elsewhere in the tree, as printed by nix-store
+}
+
+// listDeps lists the direct dependencies of a package, or with reverse the
+// installed packages that depend on it.
+func listDeps(ctx context.Context, r Runner, manager, id string, reverse bool) ([]*depNode, error) {
+	var argv []string
+	parse := parseDepNames
+	switch key := managerKey(manager); key {
+	case "apt":
+		argv = []string{"apt-cache", "depends", "--important", id}
+		parse = parseAptCacheDepends
+		if reverse {
+			argv = []string{"apt-cache", "rdepends", "--installed", id}
+		}
+	case "pacman":
+		argv = []string{"pactree", "--depth=1", "--unique", id}
+		if reverse {
+			argv = []string{"pactree", "--reverse", "--depth=1", "--unique", id}
+		}
+	case "dnf":
+		argv = []string{"dnf", "repoquery", "--installed", "--requires", "--resolve", "--queryformat", `%{name}\n`, id}
+		if reverse {
+			argv = []string{"dnf", "repoquery", "--installed", "--whatrequires", id, "--queryformat", `%{name}\n`}
+		}
+	case "brew":
+		argv, parse = []string{"brew", "deps", "--tree", id}, parseDepTree
+		if reverse {
+			argv, parse = []string{"brew", "uses", "--installed", id}, parseDepNames
+		}
+	case "nix-env", "nix-profile":
+		argv, parse = []string{"nix-store", "--query", "--tree", id}, parseDepTree
+		if reverse {
+			argv, parse = []string{"nix-store", "--query", "--referrers", id}, parseDepNames
+		}
+	default:
+		return nil, fmt.Errorf("dependencies are not supported by %s", manager)
+	}
+
+	out, err := r.Output(ctx, argv[0], argv[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	// Some list the package itself, e.g. the root of pactree's tree
+	return slices.DeleteFunc(parse(out), func(n *depNode) bool { return n.ID == id }), nil
+}
+
+// depRootID returns what the manager is asked about a package: the store
+// path of its output for Nix, its name for the others.
+func depRootID(ctx context.Context, r Runner, pkg Package) (string, error) {
+	switch managerKey(pkg.Manager) {
+	case "nix-env":
+		out, err := r.Output(ctx, "nix-env", "--query", "--out-path", pkg.Name)
+		if err != nil {
+			return "", err
+		}
+		if path := nixOutPath(out); path != "" {
+			return path, nil
+		}
+	case "nix-profile":
+		out, err := r.Output(ctx, "nix", nixProfileListArgs...)
+		if err != nil {
+			return "", err
+		}
+		if path := nixProfileStorePath(out, pkg.Name); path != "" {
+			return path, nil
+		}
+	default:
+		return pkg.Name, nil
+	}
+	return "", fmt.Errorf("store path of %s not found", pkg.Name)
+}
+
+// nixOutPath parses `nix-env -q --out-path name`: "name-version path", or
+// "name-version out=path;man=path" for packages with several outputs.
+func nixOutPath(out []byte) string {
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, output := range strings.Split(fields[1], ";") {
+			if path, ok := strings.CutPrefix(output, "out="); ok || !strings.Contains(output, "=") {
+				if !ok {
+					path = output
+				}
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// nixProfileStorePath finds the store path of a package in `nix profile list
+// --json`.
+func nixProfileStorePath(out []byte, name string) string {
+	var manifest struct {
+		Elements json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal(out, &manifest); err != nil {
+		return ""
+	}
+	elements := make(map[string]nixProfileElement)
+	if err := json.Unmarshal(manifest.Elements, &elements); err == nil {
+		if e, ok := elements[name]; ok && len(e.StorePaths) > 0 {
+			return e.StorePaths[0]
+		}
+		return ""
+	}
+	var list []nixProfileElement
+	if err := json.Unmarshal(manifest.Elements, &list); err != nil {
+		return ""
+	}
+	for _, e := range list {
+		if strings.HasSuffix("."+e.AttrPath, "."+name) && len(e.StorePaths) > 0 {
+			return e.StorePaths[0]
+		}
+	}
+	return ""
+}
+
+// newDepNode names the node of a package or store path.
+func newDepNode(id string) *depNode {
+	name := id
+	if strings.HasPrefix(id, "/nix/store/") {
+		name = storePathName(id)
+	}
+	return &depNode{Name: name, ID: id}
+}
+
+// parseDepNames parses one package per line, e.g. `brew uses`, `pactree -u`
+// or `dnf repoquery`, whose dnf4 version prints the "\n" of the query format.
+func parseDepNames(out []byte) []*depNode {
+	var nodes []*depNode
+	seen := make(map[string]bool)
+	for _, line := range outputLines(out) {
+		name := strings.TrimSuffix(strings.TrimSpace(line), `\n`)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		nodes = append(nodes, newDepNode(name))
+	}
+	return nodes
+}
+
+// parseAptCacheDepends parses `apt-cache depends`: "  Depends: name" per
+// dependency, "|" marking alternatives, with the providers of virtual
+// packages ("<name>") indented under them. `apt-cache rdepends` lists the
+// names under a "Reverse Depends:" header instead. Only the field names are
+// translated.
+func parseAptCacheDepends(out []byte) []*depNode {
+	var nodes []*depNode
+	seen := make(map[string]bool)
+	for i, line := range outputLines(out) {
+		if i == 0 || strings.HasSuffix(line, ":") || strings.HasPrefix(line, "    ") {
+			continue // The package itself, the header of rdepends, or a provider
+		}
+		name := line
+		if _, value, ok := strings.Cut(line, ": "); ok {
+			name = value
+		}
+		name = strings.TrimLeft(strings.TrimSpace(name), "|")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		nodes = append(nodes, newDepNode(name))
+	}
+	return nodes
+}
+
+// parseDepTree parses the trees drawn by `brew deps --tree` ("├── name") and
+// `nix-store -q --tree` ("├───/nix/store/..."): the package itself, then its
+// dependencies indented by 4 columns per level. nix-store marks the paths it
+// already expanded with "[...]".
+func parseDepTree(out []byte) []*depNode {
+	root := &depNode{Loaded: true}
+	stack := []*depNode{root}
+	for i, line := range outputLines(out) {
+		if i == 0 {
+			continue // The package itself
+		}
+		name := strings.TrimLeft(line, "│├└─| `-")
+		depth := utf8.RuneCountInString(line[:len(line)-len(name)]) / 4
+		if depth < 1 || depth > len(stack) {
+			continue
+		}
+		n := newDepNode(strings.TrimSpace(name))
+		if id, ok := strings.CutSuffix(n.ID, " [...]"); ok {
+			n = newDepNode(id)
+			n.Repeated = true
+		} else {
+			n.Loaded = true
+		}
+		stack = stack[:depth]
+		parent := stack[depth-1]
+		parent.Children = append(parent.Children, n)
+		stack = append(stack, n)
+	}
+	return root.Children
+}
+
+// depsMsg carries the dependencies loaded for a node of the dependency panel.
+type depsMsg struct {
+	node     *depNode
+	id       string // The ID of the node, once known
+	children []*depNode
+	err      error
+}
+
+func loadDeps(r Runner, pkg Package, node *depNode, reverse bool) tea.Cmd {
+	return func() tea.Msg {
+		ctx := context.Background()
+		id := node.ID
+		if id == "" {
+			var err error
+			if id, err = depRootID(ctx, r, pkg); err != nil {
+				return depsMsg{node: node, err: err}
+			}
+		}
+		children, err := listDeps(ctx, r, pkg.Manager, id, reverse)
+		return depsMsg{node: node, id: id, children: children, err: err}
+	}
+}
+
+// depTree is the dependency panel of a package: what it depends on, or with
+// reverse what depends on it, i.e. what pulls it in.
+type depTree struct {
+	pkg      Package
+	rootID   string // What the manager is asked about pkg, once known
+	reverse  bool
+	forward  *depNode
+	backward *depNode
+	cursor   int
+	loading  *depNode // Node whose children are being listed
+}
+
+func newDepTree(pkg Package) *depTree {
+	return &depTree{
+		pkg:      pkg,
+		forward:  &depNode{Name: pkg.Name, Expanded: true},
+		backward: &depNode{Name: pkg.Name, Expanded: true},
+	}
+}
+
+func (t *depTree) root() *depNode {
+	if t.reverse {
+		return t.backward
+	}
+	return t.forward
+}
+
+// depRow is a node as shown in the panel.
+type depRow struct {
+	node   *depNode
+	parent *depNode
+	depth  int
+}
+
+// rows lists the visible nodes, depth first.
+func (t *depTree) rows() []depRow {
+	var rows []depRow
+	var walk func(n, parent *depNode, depth int)
+	walk = func(n, parent *depNode, depth int) {
+		rows = append(rows, depRow{node: n, parent: parent, depth: depth})
+		if n.Expanded {
+			for _, c := range n.Children {
+				walk(c, n, depth+1)
+			}
+		}
+	}
+	walk(t.root(), nil, 0)
+	return rows
+}
+
+// expand shows the children of a node, loading them first if needed.
+func (t *depTree) expand(r Runner, n *depNode) tea.Cmd {
+	if !n.Loaded {
+		if t.loading != nil {
+			return nil
+		}
+		// The roots share the ID of the package, which may take a query to find
+		if n.ID == "" {
+			n.ID = t.rootID
+		}
+		t.loading = n
+		return loadDeps(r, t.pkg, n, t.reverse)
+	}
+	n.Expanded = true
+	return nil
+}
+
+// loaded fills in the children of a node, and returns the status to show.
+func (t *depTree) loaded(msg depsMsg) string {
+	t.loading = nil
+	n := msg.node
+	if (n == t.forward || n == t.backward) && msg.id != "" {
+		t.rootID = msg.id
+	}
+	if msg.err != nil && t.reverse {
+		return fmt.Sprintf("Failed to list what depends on %s: %v", n.Name, msg.err)
+	} else if msg.err != nil {
+		return fmt.Sprintf("Failed to list the dependencies of %s: %v", n.Name, msg.err)
+	}
+	n.ID, n.Children, n.Loaded, n.Expanded = msg.id, msg.children, true, true
+	n.Repeated = false
+	return t.status()
+}
+
+func (t *depTree) status() string {
+	root := t.root()
+	switch {
+	case t.loading != nil:
+		return "Listing the dependencies of " + t.loading.Name + "..."
+	case !root.Loaded:
+		return ""
+	case t.reverse && len(root.Children) == 0:
+		return "No installed package depends on " + root.Name
+	case t.reverse:
+		return "Installed packages that depend on " + root.Name
+	case len(root.Children) == 0:
+		return root.Name + " has no dependencies"
+	}
+	return "Dependencies of " + root.Name
+}
+
+// label is how a node is shown: an arrow if it can be expanded or collapsed.
+func (row depRow) label() string {
+	n := row.node
+	marker := "  "
+	switch {
+	case n.Expanded && len(n.Children) > 0:
+		marker = "▾ "
+	case !n.Loaded || len(n.Children) > 0:
+		marker = "▸ "
+	}
+	label := strings.Repeat("  ", row.depth) + marker + n.Name
+	if n.Repeated {
+		label += " [...]"
+	}
+	return label
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// depNames draws nodes as "name(child child) name [...]" to compare trees.
+func depNames(nodes []*depNode) string {
+	var parts []string
+	for _, n := range nodes {
+		s := n.Name
+		if n.Repeated {
+			s += " [...]"
+		}
+		if len(n.Children) > 0 {
+			s += "(" + depNames(n.Children) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+const nixHello = "/nix/store/63l345l7dgcfz789w1y93j1540czafqh-hello-2.12.1"
+
+func TestListDeps(t *testing.T) {
+	tests := []struct {
+		dir, manager, id string
+		reverse          bool
+		want             string
+	}{
+		// Virtual packages, their providers and alternatives
+		{"ubuntu", "apt/dpkg", "adduser", false, "passwd <debconf-2.0> debconf cdebconf"},
+		{"ubuntu", "apt/dpkg", "adduser", true, "ubuntu-minimal systemd cron"},
+		// pactree lists the package itself
+		{"arch", "pacman", "linux", false, "coreutils kmod mkinitcpio"},
+		{"arch", "pacman", "linux", true, ""},
+		{"brew", "brew", "python@3.12", false, "mpdecimal openssl@3(ca-certificates) sqlite(readline) xz"},
+		{"brew", "brew", "openssl@3", true, "python@3.12"},
+		// Paths nix-store already expanded are marked
+		{"nix-profile", "nix-profile", nixHello, false, "glibc-2.39-5(libidn2-2.3.7(libunistring-1.2(libunistring-1.2 [...]) libidn2-2.3.7 [...]) xgcc-13.2.0-libgcc glibc-2.39-5 [...])"},
+	}
+	for _, tt := range tests {
+		r := fixtureRunner{dir: "testdata/fixtures/" + tt.dir}
+		nodes, err := listDeps(context.Background(), r, tt.manager, tt.id, tt.reverse)
+		if err != nil {
+			t.Errorf("%s %s (reverse %v): %v", tt.manager, tt.id, tt.reverse, err)
+			continue
+		}
+		if got := depNames(nodes); got != tt.want {
+			t.Errorf("%s %s (reverse %v) = %q, want %q", tt.manager, tt.id, tt.reverse, got, tt.want)
+		}
+	}
+
+	if _, err := listDeps(context.Background(), fixtureRunner{}, "snap", "firefox", false); err == nil {
+		t.Error("snap dependencies were listed")
+	}
+}
+
+func TestDepRootID(t *testing.T) {
+	r := fixtureRunner{dir: "testdata/fixtures/nix-profile"}
+	id, err := depRootID(context.Background(), r, Package{Name: "hello", Manager: "nix-profile"})
+	if err != nil || id != nixHello {
+		t.Errorf("depRootID = %q, %v, want %s", id, err, nixHello)
+	}
+	if _, err := depRootID(context.Background(), r, Package{Name: "missing", Manager: "nix-profile"}); err == nil {
+		t.Error("a package missing from the profile has a store path")
+	}
+
+	// Found once, for both roots of the panel
+	tree := newDepTree(Package{Name: "hello", Manager: "nix-profile"})
+	tree.loaded(tree.expand(r, tree.root())().(depsMsg))
+	tree.reverse = true
+	tree.expand(r, tree.root())
+	if tree.forward.ID != nixHello || tree.backward.ID != nixHello {
+		t.Errorf("root IDs = %q and %q, want %s", tree.forward.ID, tree.backward.ID, nixHello)
+	}
+
+	// The list of older versions of nix, matched by attribute path
+	list := `{"elements": [{"attrPath": "legacyPackages.x86_64-linux.hello", "storePaths": ["` + nixHello + `"]}], "version": 2}`
+	if got := nixProfileStorePath([]byte(list), "hello"); got != nixHello {
+		t.Errorf("nixProfileStorePath = %q, want %s", got, nixHello)
+	}
+
+	outPaths := []struct{ out, want string }{
+		{"hello-2.12.1  " + nixHello + "\n", nixHello},
+		{"man-db-2.12.0  man=/nix/store/aaa-man-db-2.12.0-man;out=/nix/store/bbb-man-db-2.12.0\n", "/nix/store/bbb-man-db-2.12.0"},
+		{"", ""},
+	}
+	for _, tt := range outPaths {
+		if got := nixOutPath([]byte(tt.out)); got != tt.want {
+			t.Errorf("nixOutPath(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+// The panel lists a level at a time, and what depends on the package on Tab.
+func TestUpdateDeps(t *testing.T) {
+	m := fixtureModel(t, "ubuntu")
+	m, _ = update(m, typed("mgr:apt held:no explicit:yes")...)
+
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyCtrlG})
+	if m.deps == nil || cmd == nil {
+		t.Fatal("Ctrl+G didn't list the dependencies")
+	}
+	m, _ = update(m, cmd())
+	if m.status != "Dependencies of adduser" {
+		t.Errorf("status = %q", m.status)
+	}
+
+	// passwd, the first dependency, isn't listed until expanded
+	m, _ = update(m, tea.KeyMsg{Type: tea.KeyDown})
+	if strings.Contains(m.View(), "libpam0g") {
+		t.Fatal("the dependencies of passwd are shown before it's expanded")
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyRight})
+	if cmd == nil {
+		t.Fatal("Right didn't expand passwd")
+	}
+	m, _ = update(m, cmd())
+	if got, want := depNames(m.deps.forward.Children), "passwd(libc6 libpam-modules libpam0g) <debconf-2.0> debconf cdebconf"; got != want {
+		t.Errorf("tree = %q, want %q", got, want)
+	}
+	if !strings.Contains(m.View(), "▾ passwd") {
+		t.Errorf("passwd isn't shown expanded:\n%s", m.View())
+	}
+
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyTab})
+	if !m.deps.reverse || m.deps.cursor != 0 || cmd == nil {
+		t.Fatal("Tab didn't list what depends on adduser")
+	}
+	m, _ = update(m, cmd())
+	if m.status != "Installed packages that depend on adduser" || m.deps.backward.ID != "adduser" {
+		t.Errorf("status = %q, ID = %q", m.status, m.deps.backward.ID)
+	}
+	if got, want := depNames(m.deps.backward.Children), "ubuntu-minimal systemd cron"; got != want {
+		t.Errorf("reverse tree = %q, want %q", got, want)
+	}
+}
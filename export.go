@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportSchemaVersion is bumped whenever the exported fields change in a way
+// that readers of older exports need to know about. Version 2 added the
+// size, held, dependency and upgrade fields.
+const exportSchemaVersion = 2
+
+type inventory struct {
+	SchemaVersion int       `json:"schema_version"`
+	GeneratedAt   string    `json:"generated_at"`
+	Hostname      string    `json:"hostname"`
+	OS            string    `json:"os"`
+	Packages      []Package `json:"packages"`
+}
+
+func newInventory(pkgs []Package) inventory {
+	hostname, _ := os.Hostname()
+	if pkgs == nil {
+		pkgs = []Package{}
+	}
+	return inventory{
+		SchemaVersion: exportSchemaVersion,
+		GeneratedAt:   time.Now().UTC().Format(time.RFC3339),
+		Hostname:      hostname,
+		OS:            runtime.GOOS,
+		Packages:      pkgs,
+	}
+}
+
+// exportFormat guesses the format from the file extension, falling back to JSON.
+func exportFormat(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".csv"):
+		return "csv"
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		return "yaml"
+	case filepath.Base(path) == defaultManifest:
+		return "lazyfile"
+	default:
+		return "json"
+	}
+}
+
+func writeInventory(w io.Writer, inv inventory, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(inv)
+	case "csv":
+		return writeInventoryCSV(w, inv)
+	case "yaml", "yml":
+		return writeInventoryYAML(w, inv)
+	case "lazyfile":
+		return writeInventoryLazyfile(w, inv)
+	default:
+		return fmt.Errorf("unsupported format %q (use json, csv, yaml or lazyfile)", format)
+	}
+}
+
+// New columns go last, so that readers by position keep working.
+var csvHeader = []string{"schema_version", "name", "manager", "version", "installed", "origin", "size", "held", "dependency", "upgrade"}
+
+func writeInventoryCSV(w io.Writer, inv inventory) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	schema := strconv.Itoa(inv.SchemaVersion)
+	for _, p := range inv.Packages {
+		size := ""
+		if p.Size > 0 {
+			size = strconv.FormatInt(p.Size, 10)
+		}
+		record := []string{schema, p.Name, p.Manager, p.Version, strconv.FormatBool(p.IsInstalled), p.Origin,
+			size, strconv.FormatBool(p.Held), strconv.FormatBool(p.Dependency), p.Upgrade}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeInventoryYAML writes YAML by hand to avoid pulling in a YAML library.
+// Strings are double-quoted, which YAML reads with the same escapes as Go.
+func writeInventoryYAML(w io.Writer, inv inventory) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "schema_version: %d\n", inv.SchemaVersion)
+	fmt.Fprintf(&sb, "generated_at: %s\n", strconv.Quote(inv.GeneratedAt))
+	fmt.Fprintf(&sb, "hostname: %s\n", strconv.Quote(inv.Hostname))
+	fmt.Fprintf(&sb, "os: %s\n", strconv.Quote(inv.OS))
+	if len(inv.Packages) == 0 {
+		sb.WriteString("packages: []\n")
+	} else {
+		sb.WriteString("packages:\n")
+	}
+	for _, p := range inv.Packages {
+		fmt.Fprintf(&sb, "  - name: %s\n", strconv.Quote(p.Name))
+		fmt.Fprintf(&sb, "    manager: %s\n", strconv.Quote(p.Manager))
+		fmt.Fprintf(&sb, "    version: %s\n", strconv.Quote(p.Version))
+		fmt.Fprintf(&sb, "    installed: %t\n", p.IsInstalled)
+		if p.Origin != "" {
+			fmt.Fprintf(&sb, "    origin: %s\n", strconv.Quote(p.Origin))
+		}
+		if p.Size > 0 {
+			fmt.Fprintf(&sb, "    size: %d\n", p.Size)
+		}
+		if p.Held {
+			sb.WriteString("    held: true\n")
+		}
+		if p.Dependency {
+			sb.WriteString("    dependency: true\n")
+		}
+		if p.Upgrade != "" {
+			fmt.Fprintf(&sb, "    upgrade: %s\n", strconv.Quote(p.Upgrade))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeInventoryLazyfile writes the installed packages as a manifest for `apply`.
+func writeInventoryLazyfile(w io.Writer, inv inventory) error {
+	byManager := make(map[string][]string)
+	for _, p := range inv.Packages {
+		if p.IsInstalled {
+			mgr := managerKey(p.Manager)
+			byManager[mgr] = append(byManager[mgr], p.Name)
+		}
+	}
+	managers := make([]string, 0, len(byManager))
+	for mgr := range byManager {
+		managers = append(managers, mgr)
+	}
+	sort.Strings(managers)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# exported from %s at %s\n", inv.Hostname, inv.GeneratedAt)
+	for _, mgr := range managers {
+		fmt.Fprintf(&sb, "\n[%s]\n", mgr)
+		names := byManager[mgr]
+		sort.Strings(names)
+		for _, name := range names {
+			sb.WriteString(name + "\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// translatePackages renames packages that have a mapping to the manager to,
+// so an export from one machine can be applied on another.
+func translatePackages(pkgs []Package, to string, pkgMap *packageMap) []Package {
+	translated := make([]Package, len(pkgs))
+	for i, p := range pkgs {
+		if name, ok := pkgMap.translate(p.Name, p.Manager, to); ok {
+			p.Name = name
+			p.Manager = managerKey(to)
+			p.Version = ""
+		}
+		translated[i] = p
+	}
+	return translated
+}
+
+func writeInventoryFile(path string, inv inventory, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeInventory(f, inv, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// exportToFile writes the inventory to path, picking the format from its extension.
+func exportToFile(path string, pkgs []Package) error {
+	return writeInventoryFile(path, newInventory(pkgs), exportFormat(path))
+}
+
+// runExport implements `lazyinstaller export [--format json|csv|yaml|lazyfile] [--output file] [--to manager]`.
+func runExport(r Runner, args []string) error {
+	format := ""
+	output := ""
+	to := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--format" || arg == "-f":
+			if i+1 >= len(args) {
+				return errors.New("missing value for " + arg)
+			}
+			i++
+			format = args[i]
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--output" || arg == "-o":
+			if i+1 >= len(args) {
+				return errors.New("missing value for " + arg)
+			}
+			i++
+			output = args[i]
+		case strings.HasPrefix(arg, "--output="):
+			output = strings.TrimPrefix(arg, "--output=")
+		case arg == "--to":
+			if i+1 >= len(args) {
+				return errors.New("missing value for " + arg)
+			}
+			i++
+			to = args[i]
+		case strings.HasPrefix(arg, "--to="):
+			to = strings.TrimPrefix(arg, "--to=")
+		case globalFlag(arg):
+		default:
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+
+	if format == "" {
+		format = "json"
+		if output != "" && output != "-" {
+			format = exportFormat(output)
+		}
+	}
+
+	pkgs, _ := scanPackages(r, detectPM(r))
+	if to != "" {
+		if _, ok := pm_commands[managerKey(to)]; !ok {
+			return fmt.Errorf("unsupported package manager %q", to)
+		}
+		pkgMap, err := loadPackageMap()
+		if err != nil {
+			return fmt.Errorf("mappings: %w", err)
+		}
+		pkgs = translatePackages(pkgs, to, pkgMap)
+	}
+	inv := newInventory(pkgs)
+
+	if output == "" || output == "-" {
+		return writeInventory(os.Stdout, inv, format)
+	}
+	return writeInventoryFile(output, inv, format)
+}
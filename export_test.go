@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the export.golden.csv of the fixture dirs")
+
+// `export -f csv` of each fixture dir gives its export.golden.csv. After an
+// intended change, `go test -run TestExportGolden -update` rewrites them.
+func TestExportGolden(t *testing.T) {
+	dirs, err := filepath.Glob("testdata/fixtures/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "export.csv")
+			if err := runExport(fixtureRunner{dir: dir}, []string{"-f", "csv", "-o", output}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join(dir, "export.golden.csv")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("export differs from %s:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// A broken user mappings file fails the translation instead of being ignored.
+func TestExportBadMappings(t *testing.T) {
+	writeUserMappings(t, "{not json")
+	output := filepath.Join(t.TempDir(), "export.json")
+	err := runExport(fixtureRunner{dir: "testdata/fixtures/ubuntu"}, []string{"--to", "dnf", "-o", output})
+	if err == nil || !strings.HasPrefix(err.Error(), "mappings: ") {
+		t.Errorf("err = %v, want the mappings error", err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// packageFilter is a query typed in the search box: facets like "mgr:snap"
+// or "size:>100M", which the listed packages must all match, and words,
+// which are searched for with the package managers.
+type packageFilter struct {
+	facets []facet
+	words  []string
+}
+
+type facet struct {
+	key   string
+	match func(Package) bool
+}
+
+// facetParsers turn the value of each facet into what it matches.
+var facetParsers = map[string]func(string) (func(Package) bool, error){
+	"mgr":     managerFacet,
+	"manager": managerFacet,
+	"installed": yesNoFacet(func(p Package) bool {
+		return p.IsInstalled
+	}),
+	"upgradable": yesNoFacet(func(p Package) bool {
+		return p.Upgrade != ""
+	}),
+	"held": yesNoFacet(func(p Package) bool {
+		return p.Held
+	}),
+	// Installed on purpose rather than as a dependency
+	"explicit": yesNoFacet(func(p Package) bool {
+		return p.IsInstalled && !p.Dependency
+	}),
+	"size": sizeFacet,
+}
+
+// parseFilter splits a query into facets and words. Words that look like
+// facets of an unknown kind, e.g. "libc6:amd64", are kept as words.
+func parseFilter(query string) (packageFilter, error) {
+	var f packageFilter
+	for _, word := range strings.Fields(query) {
+		key, value, ok := strings.Cut(word, ":")
+		parse, known := facetParsers[strings.ToLower(key)]
+		if !ok || !known {
+			f.words = append(f.words, word)
+			continue
+		}
+		match, err := parse(value)
+		if err != nil {
+			return packageFilter{}, fmt.Errorf("%s: %w", word, err)
+		}
+		f.facets = append(f.facets, facet{key: strings.ToLower(key), match: match})
+	}
+	return f, nil
+}
+
+// apply returns the packages matching every facet, leaving pkgs as is.
+func (f packageFilter) apply(pkgs []Package) []Package {
+	if len(f.facets) == 0 {
+		return pkgs
+	}
+	var matched []Package
+	for _, p := range pkgs {
+		if f.matches(p) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+func (f packageFilter) matches(p Package) bool {
+	for _, fc := range f.facets {
+		if !fc.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// needsUpgrades tells whether the filter needs to know the upgradable
+// packages, which are only checked when asked for.
+func (f packageFilter) needsUpgrades() bool {
+	for _, fc := range f.facets {
+		if fc.key == "upgradable" {
+			return true
+		}
+	}
+	return false
+}
+
+// managerFacet matches the managers named in a comma-separated list, by
+// label or key: "flatpak" matches flatpak and flatpak-user, "apt" and "dpkg"
+// both match apt/dpkg.
+func managerFacet(value string) (func(Package) bool, error) {
+	if value == "" {
+		return nil, errors.New("name a package manager, e.g. mgr:flatpak")
+	}
+	names := strings.Split(strings.ToLower(value), ",")
+	return func(p Package) bool {
+		for _, part := range append(strings.Split(p.Manager, "/"), managerKey(p.Manager)) {
+			for _, name := range names {
+				if part == name || strings.HasPrefix(part, name+"-") {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+// yesNoFacet matches with "yes" the packages is reports, and the others
+// with "no".
+func yesNoFacet(is func(Package) bool) func(string) (func(Package) bool, error) {
+	return func(value string) (func(Package) bool, error) {
+		switch strings.ToLower(value) {
+		case "yes", "y", "true", "1":
+			return is, nil
+		case "no", "n", "false", "0":
+			return func(p Package) bool { return !is(p) }, nil
+		}
+		return nil, errors.New("use yes or no")
+	}
+}
+
+// sizeFacet compares the installed size with a size like "100M" (KiB, MiB,
+// GiB or TiB), after >, <, >= or <=. Packages of unknown size never match.
+func sizeFacet(value string) (func(Package) bool, error) {
+	op := ">="
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(value, o); ok {
+			op, value = o, rest
+			break
+		}
+	}
+	size, ok := parseSizeLimit(value)
+	if !ok {
+		return nil, errors.New("use a size like >100M or <1G")
+	}
+	return func(p Package) bool {
+		if p.Size <= 0 {
+			return false
+		}
+		switch op {
+		case ">":
+			return p.Size > size
+		case "<":
+			return p.Size < size
+		case "<=":
+			return p.Size <= size
+		case "=":
+			return p.Size == size
+		}
+		return p.Size >= size
+	}, nil
+}
+
+// parseSizeLimit parses "100M", "1.5GiB" or "512k" in powers of 1024.
+func parseSizeLimit(s string) (int64, bool) {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int64(n * float64(int64(1)<<shift)), true
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestParseSizeLimit(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"100M", 100 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{"512k", 512 << 10, true},
+		{"2TB", 2 << 40, true},
+		{"4096", 4096, true},
+		{"lots", 0, false},
+		{"-1M", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSizeLimit(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseSizeLimit(%q) = %d, %v, want %d, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSizeFacet(t *testing.T) {
+	const mib = 1 << 20
+	tests := []struct {
+		value string
+		size  int64
+		want  bool
+	}{
+		{">100M", 101 * mib, true},
+		{">100M", 100 * mib, false},
+		{"<=1.5GiB", 1536 * mib, true},
+		{"<=1.5GiB", 1537 * mib, false},
+		{"512k", 512 << 10, true}, // At least
+		{"512k", 511 << 10, false},
+		// Packages of unknown size never match
+		{"<1G", 0, false},
+		{"<1G", -1, false},
+	}
+	for _, tt := range tests {
+		match, err := sizeFacet(tt.value)
+		if err != nil {
+			t.Errorf("sizeFacet(%q): %v", tt.value, err)
+			continue
+		}
+		if got := match(Package{Size: tt.size}); got != tt.want {
+			t.Errorf("size:%s on %d bytes = %v, want %v", tt.value, tt.size, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{">big", "=>1M", ""} {
+		if _, err := sizeFacet(value); err == nil {
+			t.Errorf("sizeFacet(%q) accepted", value)
+		}
+	}
+}
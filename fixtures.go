@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Fixtures are plain files named after the command line, with every character
+// that isn't safe in a file name replaced by '_':
+//
+//	dir/dpkg-query_-W_-f___binary_Package____Version__.out  standard output
+//	dir/dpkg-query_-W_-f___binary_Package____Version__.err  error, if it failed
+//	dir/path                                                binaries found in PATH, one per line
+//	dir/snapd_GET__v2_snaps.json                            snapd API response body
+//
+// They make it possible to run the whole TUI against another machine's
+// package managers, e.g. to reproduce a parsing bug from a user's recording.
+//
+// testdata/fixtures/ holds captured outputs with their edge cases, each with
+// the expected `export -f csv` output in export.golden.csv, which
+// TestExportGolden checks and `go test -run TestExportGolden -update` rewrites:
+//
+//	LAZYINSTALLER_FIXTURES=testdata/fixtures/ubuntu lazyinstaller export -f csv |
+//		diff testdata/fixtures/ubuntu/export.golden.csv -
+
+func fixtureName(name string, args ...string) string {
+	line := strings.Join(append([]string{name}, args...), " ")
+	// Keep long command lines (e.g. with many package names) under the
+	// file name length limit
+	if len(line) > 120 {
+		line = fmt.Sprintf("%s_%x", line[:100], sha256.Sum256([]byte(line)))
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, line)
+}
+
+// fixtureRunner replays recorded outputs instead of running commands.
+// Interactive commands are not run either, they only print their command line.
+type fixtureRunner struct {
+	dir string
+}
+
+func (r fixtureRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(r.dir, fixtureName(name, args...))
+	if msg, err := os.ReadFile(base + ".err"); err == nil {
+		out, _ := os.ReadFile(base + ".out")
+		return out, errors.New(strings.TrimSpace(string(msg)))
+	}
+	out, err := os.ReadFile(base + ".out")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no fixture for %q", formatArgv(append([]string{name}, args...)))
+	}
+	return out, err
+}
+
+func (r fixtureRunner) Command(ctx context.Context, name string, args ...string) Cmd {
+	return &fixtureCmd{argv: append([]string{name}, args...), stdout: os.Stdout}
+}
+
+func (r fixtureRunner) LookPath(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, "path"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == name || filepath.Base(line) == name {
+			if !filepath.IsAbs(line) {
+				line = "/usr/bin/" + line
+			}
+			return line, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+func (r fixtureRunner) SnapdTransport() http.RoundTripper {
+	return fixtureTransport{dir: r.dir}
+}
+
+// fixtureTransport answers snapd API requests from the fixtures.
+type fixtureTransport struct {
+	dir string
+}
+
+func snapdFixtureName(req *http.Request) string {
+	return fixtureName("snapd", req.Method, req.URL.RequestURI()) + ".json"
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := os.ReadFile(filepath.Join(t.dir, snapdFixtureName(req)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no fixture for snapd %s %s", req.Method, req.URL.RequestURI())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+type fixtureCmd struct {
+	argv   []string
+	stdout io.Writer
+}
+
+func (c *fixtureCmd) Run() error {
+	_, err := fmt.Fprintf(c.stdout, "[fixture] %s\n", formatArgv(c.argv))
+	return err
+}
+
+func (c *fixtureCmd) SetStdin(io.Reader)    {}
+func (c *fixtureCmd) SetStdout(w io.Writer) { c.stdout = w }
+func (c *fixtureCmd) SetStderr(io.Writer)   {}
+
+// recordingRunner runs the real commands and saves their outputs as fixtures.
+type recordingRunner struct {
+	dir  string
+	next Runner
+}
+
+func (r recordingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := r.next.Output(ctx, name, args...)
+	if ctx.Err() != nil {
+		return out, err // Cancelled, not worth recording
+	}
+	if mkErr := os.MkdirAll(r.dir, 0o755); mkErr != nil {
+		return out, err
+	}
+	base := filepath.Join(r.dir, fixtureName(name, args...))
+	_ = os.WriteFile(base+".out", out, 0o644)
+	if err != nil {
+		_ = os.WriteFile(base+".err", []byte(err.Error()+"\n"), 0o644)
+	} else {
+		_ = os.Remove(base + ".err")
+	}
+	return out, err
+}
+
+func (r recordingRunner) Command(ctx context.Context, name string, args ...string) Cmd {
+	return r.next.Command(ctx, name, args...)
+}
+
+func (r recordingRunner) SnapdTransport() http.RoundTripper {
+	return recordingTransport{dir: r.dir, next: unixSocketTransport(snapdSocket)}
+}
+
+// recordingTransport saves the snapd API responses as fixtures.
+type recordingTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil && os.MkdirAll(t.dir, 0o755) == nil {
+		_ = os.WriteFile(filepath.Join(t.dir, snapdFixtureName(req)), body, 0o644)
+	}
+	return resp, err
+}
+
+func (r recordingRunner) LookPath(name string) (string, error) {
+	path, err := r.next.LookPath(name)
+	if err != nil || os.MkdirAll(r.dir, 0o755) != nil {
+		return path, err
+	}
+	if _, known := (fixtureRunner{dir: r.dir}).LookPath(name); known == nil {
+		return path, err
+	}
+	f, ferr := os.OpenFile(filepath.Join(r.dir, "path"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if ferr == nil {
+		fmt.Fprintln(f, path)
+		f.Close()
+	}
+	return path, err
+}
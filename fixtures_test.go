@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want string
+	}{
+		{[]string{"snap", "list"}, "snap_list"},
+		{[]string{"dpkg-query", "-W", "-f=${binary:Package}\t${Version}\n"}, "dpkg-query_-W_-f___binary_Package____Version__"},
+		{[]string{"nix-env", "-q", "--json"}, "nix-env_-q_--json"},
+	}
+	for _, tt := range tests {
+		if got := fixtureName(tt.argv[0], tt.argv[1:]...); got != tt.want {
+			t.Errorf("fixtureName(%q) = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+}
+
+// stubRunner answers every command with its command line, and fails those
+// named in fail.
+type stubRunner struct {
+	execRunner
+	fail map[string]bool
+}
+
+func (r stubRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out := []byte(formatArgv(append([]string{name}, args...)) + "\n")
+	if r.fail[name] {
+		return out, errors.New("exit status 1")
+	}
+	return out, nil
+}
+
+func (r stubRunner) LookPath(name string) (string, error) {
+	return "/opt/bin/" + name, nil
+}
+
+// What a recordingRunner records, a fixtureRunner replays: outputs, errors
+// and the binaries found in PATH.
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	rec := recordingRunner{dir: dir, next: stubRunner{fail: map[string]bool{"guix": true}}}
+	ctx := context.Background()
+	if _, err := rec.LookPath("apt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.LookPath("apt"); err != nil { // Recorded once
+		t.Fatal(err)
+	}
+	rec.Output(ctx, "apt", "search", "fd")
+	rec.Output(ctx, "guix", "package", "-I")
+
+	r := fixtureRunner{dir: dir}
+	if path, err := r.LookPath("apt"); err != nil || path != "/opt/bin/apt" {
+		t.Errorf("LookPath(apt) = %q, %v", path, err)
+	}
+	if _, err := r.LookPath("dnf"); err == nil {
+		t.Error("LookPath(dnf) found an unrecorded binary")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "path")); string(data) != "/opt/bin/apt\n" {
+		t.Errorf("path = %q, want apt once", data)
+	}
+
+	out, err := r.Output(ctx, "apt", "search", "fd")
+	if err != nil || string(out) != "apt search fd\n" {
+		t.Errorf("apt search fd = %q, %v", out, err)
+	}
+	out, err = r.Output(ctx, "guix", "package", "-I")
+	if err == nil || err.Error() != "exit status 1" || string(out) != "guix package -I\n" {
+		t.Errorf("guix package -I = %q, %v, want its output and error", out, err)
+	}
+	if _, err := r.Output(ctx, "apt", "search", "bat"); err == nil {
+		t.Error("an unrecorded command succeeded")
+	}
+}
+
+// Commands aren't run by the fixture runner, only printed.
+func TestFixtureCommand(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := fixtureRunner{dir: t.TempDir()}.Command(context.Background(), "sudo", "apt", "install", "fd find")
+	cmd.SetStdout(&stdout)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "[fixture] sudo apt install 'fd find'\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+// Package managers are detected from the binaries recorded in PATH.
+func TestDetectPMFromFixture(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fixture is of a Linux machine")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "path"), []byte("/usr/bin/dpkg\n/usr/bin/apt\nflatpak\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pm := range detectPM(fixtureRunner{dir: dir}) {
+		got = append(got, pm.Name+"="+pm.Path)
+	}
+	want := []string{"dpkg=/usr/bin/dpkg", "apt=/usr/bin/apt", "flatpak=/usr/bin/flatpak", "flatpak-user=/usr/bin/flatpak"}
+	if !slices.Equal(got, want) {
+		t.Errorf("detectPM = %q, want %q", got, want)
+	}
+}
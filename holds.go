@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Held packages are kept at their version by upgrades. They are held with
+// each manager's own mechanism through the Hold and Unhold templates
+// (`apt-mark hold`, `dnf versionlock`, `brew pin`, `snap refresh --hold`,
+// `flatpak mask`), so the managers honour them by themselves.
+//
+// pacman's IgnorePkg can only be set in pacman.conf, so pacman packages held
+// from lazyinstaller are kept in holds.json in the config directory instead,
+// and passed to pacman with --ignore. A `pacman -Syu` run outside
+// lazyinstaller upgrades them, so they are labelled "lazyinstaller only".
+
+// holdLister lists the packages (or patterns, for flatpak) held by a manager.
+type holdLister struct {
+	managers []string // detected manager names that use this lister
+	key      string   // manager key of the held packages
+	argv     []string
+	parse    func([]byte) []string
+}
+
+var holdListers = []holdLister{
+	{managers: []string{"dnf"}, key: "dnf", argv: []string{"dnf", "versionlock", "list"}, parse: parseVersionlockList},
+	{managers: []string{"yum"}, key: "dnf", argv: []string{"yum", "versionlock", "list"}, parse: parseVersionlockList},
+	{managers: []string{"pacman"}, key: "pacman", argv: []string{"pacman-conf", "IgnorePkg"}, parse: parseNameList},
+	{managers: []string{"brew"}, key: "brew", argv: []string{"brew", "list", "--pinned"}, parse: parseNameList},
+	{managers: []string{"flatpak"}, key: "flatpak", argv: []string{"flatpak", "mask", "--system"}, parse: parseFlatpakMasks},
+	{managers: []string{"flatpak-user"}, key: "flatpak-user", argv: []string{"flatpak", "mask", "--user"}, parse: parseFlatpakMasks},
+	// Held apt packages and snaps are reported along with the installed ones
+}
+
+// parseNameList parses one package name per line, e.g. `brew list --pinned`.
+func parseNameList(out []byte) []string {
+	var names []string
+	for _, line := range outputLines(out) {
+		names = append(names, strings.TrimSpace(line))
+	}
+	return names
+}
+
+// parseVersionlockList parses `dnf versionlock list`. dnf4 prints a lock per
+// line as "name-epoch:version-release.*", dnf5 a stanza per lock including
+// "Package name: name".
+func parseVersionlockList(out []byte) []string {
+	var names []string
+	for _, line := range outputLines(out) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if nevra, ok := strings.CutSuffix(line, ".*"); ok && !strings.Contains(nevra, " ") {
+			// The name ends at the "-" before the epoch
+			if i := strings.Index(nevra, ":"); i > 0 {
+				if j := strings.LastIndex(nevra[:i], "-"); j > 0 {
+					names = append(names, nevra[:j])
+				}
+			}
+			continue
+		}
+		if i := strings.LastIndex(line, ": "); i > 0 && !strings.Contains(line, " = ") {
+			if name := line[i+2:]; name != "" && !strings.Contains(name, " ") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// parseFlatpakMasks parses `flatpak mask`, which lists the patterns indented
+// under a header.
+func parseFlatpakMasks(out []byte) []string {
+	var patterns []string
+	for _, line := range outputLines(out) {
+		if line[0] != ' ' && line[0] != '\t' {
+			continue
+		}
+		patterns = append(patterns, strings.TrimSpace(line))
+	}
+	return patterns
+}
+
+// holdFile is holds.json: the packages held by lazyinstaller itself, by
+// manager key.
+type holdFile map[string][]string
+
+func loadHoldFile() (holdFile, error) {
+	holds := make(holdFile)
+	path, err := configPath("holds.json")
+	if err != nil {
+		return holds, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return holds, nil
+	}
+	if err != nil {
+		return holds, err
+	}
+	if err := json.Unmarshal(data, &holds); err != nil {
+		return holds, fmt.Errorf("%s: %w", path, err)
+	}
+	return holds, nil
+}
+
+func (h holdFile) save() error {
+	path, err := configPath("holds.json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func (h holdFile) set(manager, name string, held bool) {
+	names := slices.DeleteFunc(h[manager], func(n string) bool { return n == name })
+	if held {
+		names = append(names, name)
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		delete(h, manager)
+	} else {
+		h[manager] = names
+	}
+}
+
+// scanHolds returns the held packages of the detected managers, by manager
+// key. Managers whose holds can't be listed are left out; those of holds.json
+// aren't included.
+func scanHolds(ctx context.Context, r Runner, pms []packageManager) map[string][]string {
+	holds := make(map[string][]string)
+	listed := make(map[int]bool, len(holdListers))
+	for _, p := range pms {
+		for i, l := range holdListers {
+			if listed[i] || !slices.Contains(l.managers, p.Name) {
+				continue
+			}
+			listed[i] = true
+			if out, err := r.Output(ctx, l.argv[0], l.argv[1:]...); err == nil {
+				holds[l.key] = append(holds[l.key], l.parse(out)...)
+			}
+		}
+	}
+	return holds
+}
+
+// markHeld sets Held on the packages matching the holds, and OwnHold when
+// they're those of holds.json. Holds of the managers are marked last, as
+// they override those of holds.json.
+func markHeld(pkgs []Package, holds map[string][]string, own bool) {
+	for i, p := range pkgs {
+		for _, pattern := range holds[managerKey(p.Manager)] {
+			if holdMatches(pattern, p.Name) {
+				pkgs[i].Held = true
+				pkgs[i].OwnHold = own
+				break
+			}
+		}
+	}
+}
+
+// holdMatches tells whether a hold applies to a package. Flatpak masks may
+// be patterns like "org.gnome.*".
+func holdMatches(pattern, name string) bool {
+	if strings.Contains(pattern, "*") {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	return pattern == name
+}
+
+// ownHolds returns the packages of a manager held in holds.json.
+func ownHolds(manager string) []string {
+	holds, err := loadHoldFile()
+	if err != nil {
+		return nil
+	}
+	return holds[managerKey(manager)]
+}
+
+// honourHolds adds the packages held by lazyinstaller to a pacman upgrade
+// command template as --ignore.
+func honourHolds(manager, template string) string {
+	if managerKey(manager) != "pacman" || template == "" {
+		return template
+	}
+	held := ownHolds(manager)
+	if len(held) == 0 {
+		return template
+	}
+	ignore := "--ignore=" + strings.Join(held, ",")
+	if head, ok := strings.CutSuffix(template, " x"); ok {
+		return head + " " + ignore + " x"
+	}
+	return template + " " + ignore
+}
+
+// holdJob holds or unholds a package ("hold" or "unhold"), through the
+// manager's template or else in holds.json.
+func holdJob(r Runner, action string, pkg Package) tea.Cmd {
+	cmds := pm_commands[managerKey(pkg.Manager)]
+	template := cmds.Hold
+	if action == "unhold" {
+		template = cmds.Unhold
+	}
+	if template != "" {
+		return runJob(r, action, template, pkg, pkg.Name)
+	}
+	if managerKey(pkg.Manager) != "pacman" {
+		return runJob(r, action, "", pkg, pkg.Name) // Reports it as not supported
+	}
+	return func() tea.Msg {
+		holds, err := loadHoldFile()
+		if err == nil && action == "unhold" && !slices.Contains(holds["pacman"], pkg.Name) {
+			err = errors.New("held by IgnorePkg in /etc/pacman.conf")
+		}
+		if err == nil {
+			holds.set("pacman", pkg.Name, action == "hold")
+			err = holds.save()
+		}
+		msg := jobDoneMsg{action: action, pkg: pkg, err: err}
+		if action == "hold" {
+			msg.note = "lazyinstaller only, a pacman -Syu run outside it still upgrades it"
+		}
+		return msg
+	}
+}
+
+// runUpgrade upgrades the packages of every detected manager, except the
+// held ones.
+func runUpgrade(r Runner, args []string) error {
+	for _, arg := range args {
+		if !globalFlag(arg) {
+			return fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+
+	failed := 0
+	for _, key := range availableManagers(detectPM(r)) {
+		cmds := pm_commands[key]
+		// Templates that need a package name can't upgrade everything
+		if cmds.UpgradeAll == "" || expandCommand(cmds.UpgradeAll, "") != cmds.UpgradeAll {
+			continue
+		}
+		fmt.Printf("==> %s\n", key)
+		if cmds.UpdateIndex != "" {
+			if err := executeCommand(r, cmds.UpdateIndex, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: updating the index failed: %v\n", key, err)
+			}
+		}
+		if key == "pacman" {
+			if held := ownHolds(key); len(held) > 0 {
+				fmt.Printf("Ignoring %s, held by lazyinstaller only\n", strings.Join(held, ", "))
+			}
+		}
+		if err := executeCommand(r, honourHolds(key, cmds.UpgradeAll), ""); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", key, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d package managers failed to upgrade", failed)
+	}
+	return nil
+}
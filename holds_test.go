@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// pacman packages held in holds.json are only held by lazyinstaller, unless
+// IgnorePkg holds them too, and are labelled so.
+func TestPacmanOwnHolds(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	holds := holdFile{"pacman": {"linux", "python-pip"}}
+	if err := holds.save(); err != nil {
+		t.Fatal(err)
+	}
+	r := fixtureRunner{dir: "testdata/fixtures/arch"}
+	pkgs, _ := scanPackages(r, detectPM(r))
+
+	want := map[string]string{
+		"linux":       "held ⏸", // In IgnorePkg too
+		"python-pip":  "held ⏸ (lazyinstaller only)",
+		"xorg-server": "installed ✓",
+	}
+	for _, p := range pkgs {
+		if status, ok := want[p.Name]; ok && p.Manager == "pacman" {
+			if got := packageStatus(p); got != status {
+				t.Errorf("%s: status = %q, want %q", p.Name, got, status)
+			}
+			delete(want, p.Name)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("not listed: %v", want)
+	}
+
+	if got := honourHolds("pacman", pm_commands["pacman"].UpgradeAll); !strings.HasSuffix(got, " --ignore=linux,python-pip") {
+		t.Errorf("upgrade command = %q, want the held packages ignored", got)
+	}
+
+	msg := holdJob(r, "hold", Package{Name: "xorg-server", Manager: "pacman", IsInstalled: true})().(jobDoneMsg)
+	if want := "Done: hold xorg-server (lazyinstaller only, a pacman -Syu run outside it still upgrades it)"; msg.status() != want {
+		t.Errorf("status = %q, want %q", msg.status(), want)
+	}
+}
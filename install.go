@@ -0,0 +1,572 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// packageFile is a local package file and the metadata read from it.
+type packageFile struct {
+	Path        string // Absolute
+	Kind        string // "deb", "rpm", "pacman", "flatpakref" or "snap"
+	Name        string
+	Version     string
+	Arch        string
+	Summary     string
+	URL         string // Homepage, or the repository of a .flatpakref
+	Confinement string // Snaps only
+	MetadataErr error  // Why the metadata couldn't be read, if it couldn't
+}
+
+// fileManagers lists the managers that install each kind of package file,
+// the preferred one first.
+var fileManagers = map[string][]string{
+	"deb":        {"apt"},
+	"rpm":        {"dnf", "yum", "zypper", "rpm"},
+	"pacman":     {"pacman"},
+	"flatpakref": {"flatpak", "flatpak-user"},
+	"snap":       {"snap"},
+}
+
+// fileManagerLabels are the manager labels of the scanned packages, for the
+// managers whose label is not their key.
+var fileManagerLabels = map[string]string{
+	"apt": "apt/dpkg",
+	"dnf": "rpm/dnf",
+	"rpm": "rpm/dnf",
+}
+
+// fileKindByExtension tells the kind of a package file from its name.
+func fileKindByExtension(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(base, ".deb"):
+		return "deb"
+	case strings.HasSuffix(base, ".rpm"):
+		return "rpm"
+	case strings.Contains(base, ".pkg.tar"):
+		return "pacman"
+	case strings.HasSuffix(base, ".flatpakref"):
+		return "flatpakref"
+	case strings.HasSuffix(base, ".snap"):
+		return "snap"
+	}
+	return ""
+}
+
+// fileKindByMagic tells the kind of a package file from its first bytes.
+// pacman packages are compressed tarballs, which are reported as "tar".
+func fileKindByMagic(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("!<arch>\ndebian-binary")):
+		return "deb"
+	case bytes.HasPrefix(head, []byte{0xed, 0xab, 0xee, 0xdb}):
+		return "rpm"
+	case bytes.HasPrefix(head, []byte("hsqs")): // squashfs
+		return "snap"
+	case bytes.HasPrefix(bytes.TrimLeft(head, "\ufeff \t\r\n"), []byte("[Flatpak Ref]")):
+		return "flatpakref"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}), // zstd
+		bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0}), // xz
+		bytes.HasPrefix(head, []byte{0x1f, 0x8b}),                  // gzip
+		bytes.HasPrefix(head, []byte("BZh")):                       // bzip2
+		return "tar"
+	}
+	return ""
+}
+
+// detectFileKind tells the kind of a package file from its first bytes,
+// which must agree with its extension.
+func detectFileKind(path string, head []byte) (string, error) {
+	base := filepath.Base(path)
+	byMagic, byExt := fileKindByMagic(head), fileKindByExtension(path)
+	switch {
+	case byMagic == "tar" && byExt == "pacman":
+		return "pacman", nil
+	case byMagic == "" || byMagic == "tar":
+		return "", fmt.Errorf("%s is not a package file (.deb, .rpm, .pkg.tar.zst, .flatpakref or .snap)", base)
+	case byExt != "" && byExt != byMagic:
+		return "", fmt.Errorf("%s is a %s package despite its extension", base, byMagic)
+	}
+	return byMagic, nil
+}
+
+// openPackageFile detects the kind of a package file and reads its metadata.
+// The file is returned even if its metadata can't be read, with MetadataErr
+// set.
+func openPackageFile(ctx context.Context, r Runner, path string) (packageFile, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return packageFile{}, err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return packageFile{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return packageFile{}, err
+	}
+	kind, err := detectFileKind(abs, head[:n])
+	if err != nil {
+		return packageFile{}, err
+	}
+
+	p := packageFile{Path: abs, Kind: kind}
+	switch kind {
+	case "deb":
+		p.MetadataErr = p.readDeb(ctx, r, f)
+	case "rpm":
+		p.MetadataErr = p.readRPM(f)
+	case "pacman":
+		p.MetadataErr = p.readPkgInfo(ctx, r)
+	case "flatpakref":
+		p.MetadataErr = p.readFlatpakRef(io.NewSectionReader(f, 0, 1<<20))
+	case "snap":
+		p.MetadataErr = p.readSnapYaml(ctx, r)
+	}
+	if p.Name == "" && p.MetadataErr == nil {
+		p.MetadataErr = errors.New("no package name in the metadata")
+	}
+	return p, nil
+}
+
+// readDeb reads the control file of a .deb, an ar archive whose
+// control.tar member holds it. Only gzip compressed or plain control.tar
+// members are read here, dpkg-deb reads the others.
+func (p *packageFile) readDeb(ctx context.Context, r Runner, f io.ReaderAt) error {
+	control, err := readDebControl(f)
+	if err != nil {
+		out, dpkgErr := r.Output(ctx, "dpkg-deb", "--field", p.Path)
+		if dpkgErr != nil {
+			return err
+		}
+		control = out
+	}
+	fields := parseControlFields(control)
+	p.Name = fields["Package"]
+	p.Version = fields["Version"]
+	p.Arch = fields["Architecture"]
+	p.Summary, _, _ = strings.Cut(fields["Description"], "\n")
+	p.URL = fields["Homepage"]
+	return nil
+}
+
+// readDebControl extracts the control file from the control.tar member of
+// a .deb.
+func readDebControl(f io.ReaderAt) ([]byte, error) {
+	off := int64(len("!<arch>\n"))
+	hdr := make([]byte, 60) // name, mtime, uid, gid, mode, size, magic
+	for {
+		if _, err := f.ReadAt(hdr, off); err != nil {
+			return nil, errors.New("no control.tar member")
+		}
+		name := strings.TrimRight(strings.TrimSpace(string(hdr[:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt ar member %q", name)
+		}
+		off += 60
+		if !strings.HasPrefix(name, "control.tar") {
+			off += size + size%2 // Members are aligned on 2 bytes
+			continue
+		}
+
+		var member io.Reader = io.NewSectionReader(f, off, size)
+		switch filepath.Ext(name) {
+		case ".tar":
+		case ".gz":
+			if member, err = gzip.NewReader(member); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported", name)
+		}
+		tr := tar.NewReader(member)
+		for {
+			h, err := tr.Next()
+			if err != nil {
+				return nil, errors.New("no control file in " + name)
+			}
+			if h.Name == "./control" || h.Name == "control" {
+				return io.ReadAll(io.LimitReader(tr, 1<<20))
+			}
+		}
+	}
+}
+
+// parseControlFields parses a deb822 stanza ("Field: value" lines, with
+// indented continuation lines) into its fields.
+func parseControlFields(data []byte) map[string]string {
+	fields := make(map[string]string)
+	last := ""
+	for _, line := range outputLines(data) {
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			fields[last] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		last = strings.TrimSpace(key)
+		fields[last] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// rpm header tags
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagSummary = 1004
+	rpmTagURL     = 1020
+	rpmTagArch    = 1022
+)
+
+// readRPM reads the header of an .rpm: a 96 bytes lead, then the signature
+// header padded to 8 bytes, then the header with the package's tags.
+func (p *packageFile) readRPM(f io.ReaderAt) error {
+	sigCount, sigSize, err := rpmHeaderIntro(f, 96)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	off := 96 + 16 + 16*sigCount + sigSize
+	off += (8 - off%8) % 8
+	count, size, err := rpmHeaderIntro(f, off)
+	if err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+
+	index := make([]byte, 16*count)
+	store := make([]byte, size)
+	if _, err := f.ReadAt(index, off+16); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if _, err := f.ReadAt(store, off+16+16*count); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+
+	tags := make(map[uint32]string)
+	for i := int64(0); i < count; i++ {
+		entry := index[16*i:]
+		tag := binary.BigEndian.Uint32(entry)
+		typ := binary.BigEndian.Uint32(entry[4:])
+		offset := int64(binary.BigEndian.Uint32(entry[8:]))
+		if offset >= size {
+			continue
+		}
+		switch typ {
+		case 4: // int32
+			if offset+4 <= size {
+				tags[tag] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(store[offset:])), 10)
+			}
+		case 6, 8, 9: // string, string array and i18n string: the first one
+			value, _, _ := bytes.Cut(store[offset:], []byte{0})
+			tags[tag] = string(value)
+		}
+	}
+
+	p.Name = tags[rpmTagName]
+	p.Version = tags[rpmTagVersion]
+	if release := tags[rpmTagRelease]; release != "" {
+		p.Version += "-" + release
+	}
+	if epoch := tags[rpmTagEpoch]; epoch != "" && epoch != "0" {
+		p.Version = epoch + ":" + p.Version
+	}
+	p.Arch = tags[rpmTagArch]
+	p.Summary = tags[rpmTagSummary]
+	p.URL = tags[rpmTagURL]
+	return nil
+}
+
+// rpmHeaderIntro reads the number of index entries and the size of the data
+// of the rpm header at off.
+func rpmHeaderIntro(f io.ReaderAt, off int64) (count, size int64, err error) {
+	intro := make([]byte, 16)
+	if _, err := f.ReadAt(intro, off); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.HasPrefix(intro, []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		return 0, 0, errors.New("bad magic")
+	}
+	count = int64(binary.BigEndian.Uint32(intro[8:]))
+	size = int64(binary.BigEndian.Uint32(intro[12:]))
+	if count > 1<<16 || size > 1<<26 {
+		return 0, 0, errors.New("too large")
+	}
+	return count, size, nil
+}
+
+// readPkgInfo reads the .PKGINFO of a pacman package ("key = value" lines)
+// with bsdtar, which pacman itself depends on.
+func (p *packageFile) readPkgInfo(ctx context.Context, r Runner) error {
+	out, err := r.Output(ctx, "bsdtar", "-xOf", p.Path, ".PKGINFO")
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]string)
+	for _, line := range outputLines(out) {
+		key, value, ok := strings.Cut(line, " = ")
+		if ok && fields[key] == "" {
+			fields[key] = value
+		}
+	}
+	p.Name = fields["pkgname"]
+	p.Version = fields["pkgver"]
+	p.Arch = fields["arch"]
+	p.Summary = fields["pkgdesc"]
+	p.URL = fields["url"]
+	return nil
+}
+
+// readFlatpakRef reads the [Flatpak Ref] group of a .flatpakref, which
+// names the app and the repository it's installed from.
+func (p *packageFile) readFlatpakRef(f io.Reader) error {
+	fields := make(map[string]string)
+	group := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case strings.HasPrefix(line, "["):
+			group = line
+		case group == "[Flatpak Ref]":
+			if key, value, ok := strings.Cut(line, "="); ok {
+				fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	p.Name = fields["Name"]
+	p.Version = fields["Branch"]
+	p.Summary = fields["Title"]
+	p.URL = fields["Url"]
+	return nil
+}
+
+// readSnapYaml reads the name, version, summary and confinement at the top
+// level of the meta/snap.yaml of a .snap, a squashfs image.
+func (p *packageFile) readSnapYaml(ctx context.Context, r Runner) error {
+	out, err := r.Output(ctx, "unsquashfs", "-cat", p.Path, "meta/snap.yaml")
+	if err != nil {
+		return err
+	}
+	for _, line := range outputLines(out) {
+		if line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `'"`)
+		switch key {
+		case "name":
+			p.Name = value
+		case "version":
+			p.Version = value
+		case "summary":
+			p.Summary = value
+		case "confinement":
+			p.Confinement = value
+		}
+	}
+	return nil
+}
+
+// manager picks the manager to install the file with among the available
+// ones. user prefers the per-user installation of flatpak.
+func (p packageFile) manager(available []string, user bool) (string, error) {
+	candidates := fileManagers[p.Kind]
+	if user && p.Kind == "flatpakref" {
+		candidates = []string{"flatpak-user"}
+	}
+	for _, key := range candidates {
+		for _, a := range available {
+			if a == key && pm_commands[key].InstallFile != "" {
+				return key, nil
+			}
+		}
+	}
+	if len(candidates) == 1 {
+		return "", fmt.Errorf("%s packages are installed with %s, which was not found", p.Kind, candidates[0])
+	}
+	return "", fmt.Errorf("%s packages are installed with %s, none of which was found", p.Kind, strings.Join(candidates, " or "))
+}
+
+// argv is the command that installs the file with the manager.
+func (p packageFile) argv(manager string, devmode bool) []string {
+	var flags []string
+	if p.Kind == "snap" {
+		flags = snapFileFlags(devmode || p.Confinement == "devmode")
+		if p.Confinement == "classic" {
+			flags = append(flags, snapConfinementFlag(p.Confinement))
+		}
+	}
+	return fileArgv(pm_commands[manager].InstallFile, p.Path, flags...)
+}
+
+// pkg is the package the file installs, as listed by the manager.
+func (p packageFile) pkg(manager string) Package {
+	name := p.Name
+	if name == "" {
+		name = filepath.Base(p.Path)
+	}
+	if label, ok := fileManagerLabels[manager]; ok {
+		manager = label
+	}
+	return Package{Name: name, Version: p.Version, Manager: manager}
+}
+
+// describe is a one-line preview of the package, for the status bar.
+func (p packageFile) describe() string {
+	if p.MetadataErr != nil {
+		return fmt.Sprintf("%s (%s package, metadata unavailable: %v)", filepath.Base(p.Path), p.Kind, p.MetadataErr)
+	}
+	s := strings.TrimSpace(p.Name + " " + p.Version)
+	if p.Arch != "" {
+		s += " (" + p.Arch + ")"
+	}
+	if p.Summary != "" {
+		s += ": " + p.Summary
+	}
+	if p.Confinement == "classic" || p.Confinement == "devmode" {
+		s += ", not sandboxed (" + p.Confinement + ")"
+	}
+	return s
+}
+
+// printPreview prints the metadata of the file.
+func (p packageFile) printPreview(w io.Writer, manager string) {
+	fmt.Fprintf(w, "File:        %s\n", p.Path)
+	fmt.Fprintf(w, "Type:        %s, installed with %s\n", p.Kind, manager)
+	if p.MetadataErr != nil {
+		fmt.Fprintf(w, "Metadata:    unavailable: %v\n", p.MetadataErr)
+	} else {
+		fmt.Fprintf(w, "Package:     %s\n", strings.TrimSpace(p.Name+" "+p.Version+" "+p.Arch))
+		for _, field := range [][2]string{{"Summary", p.Summary}, {"URL", p.URL}, {"Confinement", p.Confinement}} {
+			if field[1] != "" {
+				fmt.Fprintf(w, "%-12s %s\n", field[0]+":", field[1])
+			}
+		}
+	}
+}
+
+// runInstall implements `lazyinstaller install FILE [flags]`, which installs
+// a local package file with the manager for its kind.
+func runInstall(r Runner, args []string) error {
+	path, devmode, user, yes := "", false, false, false
+	for _, arg := range args {
+		if globalFlag(arg) {
+			continue
+		}
+		switch arg {
+		case "--devmode":
+			devmode = true
+		case "--user":
+			user = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			if strings.HasPrefix(arg, "-") || path != "" {
+				return fmt.Errorf("unknown argument %q", arg)
+			}
+			path = arg
+		}
+	}
+	if path == "" {
+		return errors.New("no file given")
+	}
+
+	p, err := openPackageFile(context.Background(), r, path)
+	if err != nil {
+		return err
+	}
+	manager, err := p.manager(availableManagers(detectPM(r)), user)
+	if err != nil {
+		return err
+	}
+	argv := p.argv(manager, devmode)
+	p.printPreview(os.Stdout, manager)
+	fmt.Println()
+
+	if !yes && !dryRun {
+		fmt.Printf("$ %s\nInstall it? [y/N] ", formatArgv(argv))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return errors.New("aborted")
+		}
+	}
+	return executeArgv(r, argv)
+}
+
+// fileArgv fills a file path into an InstallFile template. The path is kept
+// as one argument even if it contains spaces, followed by the flags.
+func fileArgv(template string, path string, flags ...string) []string {
+	argv := commandArgv(template, "")
+	argv = append(argv, path)
+	return append(argv, flags...)
+}
+
+// snapFileFlags are the flags of `snap install` for a local .snap file: it
+// isn't signed by the store, so it needs --dangerous, and --devmode installs
+// it without confinement, e.g. while developing it.
+func snapFileFlags(devmode bool) []string {
+	flags := []string{"--dangerous"}
+	if devmode {
+		flags = append(flags, "--devmode")
+	}
+	return flags
+}
+
+// packageFileMsg carries a package file opened from the TUI, to install it
+// once confirmed.
+type packageFileMsg struct {
+	file    packageFile
+	manager string
+	err     error
+}
+
+func loadPackageFile(r Runner, pms []packageManager, path string) tea.Cmd {
+	return func() tea.Msg {
+		p, err := openPackageFile(context.Background(), r, path)
+		if err != nil {
+			return packageFileMsg{err: err}
+		}
+		manager, err := p.manager(availableManagers(pms), false)
+		return packageFileMsg{file: p, manager: manager, err: err}
+	}
+}
+
+// fileJob installs a package file like runJob does with a template.
+func fileJob(r Runner, p packageFile, manager string) tea.Cmd {
+	return argvJob(r, "install", p.argv(manager, false), p.pkg(manager))
+}
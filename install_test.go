@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fileRunner replays the ubuntu fixtures, and bsdtar for the .PKGINFO of
+// the pacman package in testdata/files, whose path is machine specific.
+type fileRunner struct {
+	fixtureRunner
+}
+
+const helloPkgInfo = `# Generated by makepkg 6.1.0
+pkgname = hello
+pkgver = 2.10-3
+pkgdesc = Example package based on GNU hello
+url = https://www.gnu.org/software/hello/
+arch = any
+`
+
+func (r fileRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if name == "bsdtar" {
+		if filepath.Base(args[1]) != "hello-2.10-3-any.pkg.tar.zst" {
+			return nil, errors.New("not the hello package")
+		}
+		return []byte(helloPkgInfo), nil
+	}
+	return r.fixtureRunner.Output(ctx, name, args...)
+}
+
+// Each file in testdata/files is previewed, then installed in dry-run mode
+// with the manager for its kind.
+func TestInstallFiles(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	r := fileRunner{fixtureRunner{dir: "testdata/fixtures/ubuntu"}}
+	available := []string{"apt", "dnf", "pacman", "flatpak", "flatpak-user", "snap"}
+
+	tests := []struct {
+		file     string
+		manager  string
+		describe string
+		argv     string // Without the path of the file, which comes last
+	}{
+		{"hello_2.10-3_all.deb", "apt", "hello 2.10-3 (all): example package based on GNU hello", "sudo apt install"},
+		{"hello-2.10-3.fc40.noarch.rpm", "dnf", "hello 2.10-3.fc40 (noarch): Example package based on GNU hello", "sudo dnf install -y"},
+		{"hello-2.10-3-any.pkg.tar.zst", "pacman", "hello 2.10-3 (any): Example package based on GNU hello", "sudo pacman -U --noconfirm"},
+		{"org.example.Hello.flatpakref", "flatpak", "org.example.Hello stable: Hello", "sudo flatpak install --system --from"},
+		// Only a squashfs superblock, whose meta/snap.yaml can't be read
+		{"hello_2.10-3_all.snap", "snap", "hello_2.10-3_all.snap (snap package, metadata unavailable: ", "sudo snap install"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			p, err := openPackageFile(context.Background(), r, filepath.Join("testdata/files", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			manager, err := p.manager(available, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manager != tt.manager {
+				t.Errorf("manager = %s, want %s", manager, tt.manager)
+			}
+			if got := p.describe(); !strings.HasPrefix(got, tt.describe) {
+				t.Errorf("describe = %q, want %q", got, tt.describe)
+			}
+
+			var preview bytes.Buffer
+			p.printPreview(&preview, manager)
+			if !strings.Contains(preview.String(), "File:        "+p.Path+"\n") {
+				t.Errorf("preview doesn't show the file:\n%s", preview.String())
+			}
+			if p.MetadataErr == nil && !strings.Contains(preview.String(), "Package:     "+p.Name) {
+				t.Errorf("preview doesn't show the package:\n%s", preview.String())
+			}
+
+			done, ok := fileJob(r, p, manager)().(jobDoneMsg)
+			if !ok || !done.dryRun {
+				t.Fatalf("got %+v, want a dry-run jobDoneMsg", done)
+			}
+			want := tt.argv + " " + p.Path
+			if p.Kind == "snap" {
+				want += " --dangerous"
+			}
+			if got := strings.Join(done.argv, " "); got != want {
+				t.Errorf("argv = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestInstallFileRefused(t *testing.T) {
+	r := fixtureRunner{dir: "testdata/fixtures/ubuntu"}
+	for _, file := range []string{"not-a-package.deb", "README.md"} {
+		if p, err := openPackageFile(context.Background(), r, filepath.Join("testdata/files", file)); err == nil {
+			t.Errorf("%s opened as a %s package", file, p.Kind)
+		}
+	}
+}
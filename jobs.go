@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// jobDoneMsg reports the end of a command started from the TUI.
+type jobDoneMsg struct {
+	action string
+	pkg    Package
+	argv   []string
+	method string // Of PackageKit, for jobs that go through it instead of argv
+	dryRun bool
+	err    error
+	note   string // Added to the status once done
+}
+
+// runJob runs a command template for a package, handing the terminal over to
+// it so sudo can prompt for a password. In dry-run mode it only reports the
+// command it would have run.
+func runJob(r Runner, action string, template string, pkg Package, spec string) tea.Cmd {
+	argv := commandArgv(template, spec)
+	if len(argv) == 0 {
+		return func() tea.Msg {
+			return jobDoneMsg{action: action, pkg: pkg, err: fmt.Errorf("%s is not supported by %s", action, pkg.Manager)}
+		}
+	}
+
+	return argvJob(r, action, argv, pkg)
+}
+
+// argvJob runs a command for a package like runJob, once it's filled in.
+func argvJob(r Runner, action string, argv []string, pkg Package) tea.Cmd {
+	if dryRun {
+		return func() tea.Msg {
+			return jobDoneMsg{action: action, pkg: pkg, argv: argv, dryRun: true}
+		}
+	}
+
+	c := r.Command(context.Background(), argv[0], argv[1:]...)
+	return tea.Exec(c, func(err error) tea.Msg {
+		return jobDoneMsg{action: action, pkg: pkg, argv: argv, err: err}
+	})
+}
+
+// packageJob starts the given action ("install", "uninstall" or "upgrade")
+// on a package using its manager's command templates. Snaps go through the
+// snapd API instead, unless in dry-run mode, and system packages through
+// PackageKit if pk is not nil.
+func packageJob(r Runner, pk *packageKitClient, action string, pkg Package) tea.Cmd {
+	switch {
+	case managerKey(pkg.Manager) == "snap" && action == "install":
+		return snapConfinementJob(r, action, pkg, "")
+	case pk != nil && pk.handles(pkg.Manager):
+		return packageKitJob(pk, action, pkg)
+	case dryRun:
+	case managerKey(pkg.Manager) == "snap":
+		return snapJob(r, action, pkg, snapdAction{Action: snapdVerbs[action]})
+	}
+	return templateJob(r, action, pkg)
+}
+
+// jobCommand returns the command packageJob runs for an action, to show it
+// before it's confirmed, or "" if the manager has none.
+func jobCommand(pk *packageKitClient, action string, pkg Package) string {
+	if pk != nil && pk.handles(pkg.Manager) {
+		return "PackageKit " + pkMethods[action] + " " + pkg.Name
+	}
+	return formatArgv(commandArgv(actionTemplate(pkg.Manager, action), pkg.Name))
+}
+
+// templateJob runs the action through the manager's command template.
+func templateJob(r Runner, action string, pkg Package) tea.Cmd {
+	return runJob(r, action, actionTemplate(pkg.Manager, action), pkg, pkg.Name)
+}
+
+// actionTemplate returns the command template of a job action.
+func actionTemplate(manager string, action string) string {
+	cmds := pm_commands[managerKey(manager)]
+	switch action {
+	case "install":
+		return cmds.Install
+	case "uninstall":
+		return cmds.Uninstall
+	case "upgrade":
+		return honourHolds(manager, cmds.Upgrade)
+	}
+	return ""
+}
+
+// snapdChangeMsg reports the progress of a snapd change started from the TUI.
+type snapdChangeMsg struct {
+	action string
+	pkg    Package
+	snapd  snapdAction // What was asked to snapd, to retry it with the template
+	id     string
+	change snapdChange
+	err    error
+}
+
+// snapdVerbs maps job actions to snapd actions.
+var snapdVerbs = map[string]string{
+	"install":   "install",
+	"uninstall": "remove",
+	"upgrade":   "refresh",
+}
+
+// snapJob starts a snapd change, or in dry-run mode reports the command
+// line of the same action.
+func snapJob(r Runner, action string, pkg Package, a snapdAction) tea.Cmd {
+	if dryRun {
+		return runJob(r, action, actionTemplate(pkg.Manager, action), pkg, a.spec(pkg.Name))
+	}
+	return func() tea.Msg {
+		id, err := newSnapdClient(r).act(context.Background(), pkg.Name, a)
+		return snapdChangeMsg{action: action, pkg: pkg, snapd: a, id: id, err: err}
+	}
+}
+
+// snapConfinementMsg reports the confinement of a snap about to be installed
+// or switched to another channel.
+type snapConfinementMsg struct {
+	action      string
+	pkg         Package
+	channel     string
+	confinement string
+	err         error
+}
+
+// snapConfinementJob looks up the confinement of a snap in the store before
+// installing it, as classic and devmode snaps must be asked for.
+func snapConfinementJob(r Runner, action string, pkg Package, channel string) tea.Cmd {
+	return func() tea.Msg {
+		confinement, err := newSnapdClient(r).confinement(context.Background(), pkg.Name, channel)
+		return snapConfinementMsg{action: action, pkg: pkg, channel: channel, confinement: confinement, err: err}
+	}
+}
+
+// handleSnapConfinement starts the job once the confinement is known. Snaps
+// that are not confined are only installed once the user confirms, so prompt
+// is not empty for them.
+func handleSnapConfinement(r Runner, msg snapConfinementMsg) (status string, prompt string, cmd tea.Cmd) {
+	a := snapdAction{
+		Action:  snapdVerbs[msg.action],
+		Channel: msg.channel,
+		Classic: msg.confinement == "classic",
+		DevMode: msg.confinement == "devmode",
+	}
+	cmd = snapJob(r, msg.action, msg.pkg, a)
+	switch {
+	case msg.err != nil:
+		// Let snapd tell if it needs classic confinement
+		return fmt.Sprintf("Couldn't check the confinement of %s: %v", msg.pkg.Name, msg.err), "", cmd
+	case a.Classic:
+		prompt = msg.pkg.Name + " uses classic confinement: it isn't sandboxed and can access the whole system."
+	case a.DevMode:
+		prompt = msg.pkg.Name + " is published in devmode: it isn't sandboxed and may be unstable."
+	default:
+		return "", "", cmd
+	}
+	return "", prompt + " Press Enter to " + msg.action + " it anyway, any other key to cancel", cmd
+}
+
+// pollSnapdChange checks the progress of a change again after a while.
+func pollSnapdChange(r Runner, msg snapdChangeMsg) tea.Cmd {
+	return tea.Tick(300*time.Millisecond, func(time.Time) tea.Msg {
+		ch, err := newSnapdClient(r).change(context.Background(), msg.id)
+		msg.change, msg.err = ch, err
+		return msg
+	})
+}
+
+// handleSnapdChange follows a change until it's ready, then reports it as a
+// finished job. If snapd refuses the user, the job falls back to the
+// template, which uses sudo.
+func handleSnapdChange(r Runner, msg snapdChangeMsg) (string, tea.Cmd) {
+	var e *snapdError
+	switch {
+	case errors.As(msg.err, &e) && e.accessDenied():
+		return "snapd denied access, retrying with sudo...", runJob(r, msg.action, actionTemplate(msg.pkg.Manager, msg.action), msg.pkg, msg.snapd.spec(msg.pkg.Name))
+	case msg.err != nil, msg.change.Ready:
+		done := jobDoneMsg{action: msg.action, pkg: msg.pkg, err: msg.err}
+		if done.err == nil && msg.change.Status != "Done" {
+			done.err = msg.change.failure()
+		}
+		return "", func() tea.Msg { return done }
+	default:
+		status := "snap: " + msg.change.progress()
+		if msg.change.ID == "" {
+			status = fmt.Sprintf("snap: %s %s...", snapdVerbs[msg.action], msg.pkg.Name)
+		}
+		return status, pollSnapdChange(r, msg)
+	}
+}
+
+// packageKitMsg reports the progress of a PackageKit transaction started
+// from the TUI. The next update, ending with a jobDoneMsg, comes from updates.
+type packageKitMsg struct {
+	action  string
+	pkg     Package
+	percent uint32
+	updates <-chan tea.Msg
+}
+
+// packageKitJob runs the action through PackageKit, or in dry-run mode
+// reports the PackageKit method it would have called.
+func packageKitJob(pk *packageKitClient, action string, pkg Package) tea.Cmd {
+	if dryRun {
+		return func() tea.Msg {
+			return jobDoneMsg{action: action, pkg: pkg, method: pkMethods[action], dryRun: true}
+		}
+	}
+	return func() tea.Msg {
+		updates := make(chan tea.Msg, 1)
+		go func() {
+			err := pk.run(context.Background(), action, pkg.Name, func(percent uint32) {
+				select {
+				case updates <- packageKitMsg{action: action, pkg: pkg, percent: percent, updates: updates}:
+				default: // The TUI hasn't shown the previous one yet
+				}
+			})
+			updates <- jobDoneMsg{action: action, pkg: pkg, err: err}
+		}()
+		return <-updates
+	}
+}
+
+// waitPackageKit waits for the next update of a PackageKit job.
+func waitPackageKit(updates <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+func (msg packageKitMsg) status() string {
+	return fmt.Sprintf("PackageKit: %s %s %d%%", msg.action, msg.pkg.Name, msg.percent)
+}
+
+func (msg jobDoneMsg) status() string {
+	switch {
+	case msg.dryRun && msg.method != "":
+		return fmt.Sprintf("[dry-run] PackageKit %s %s", msg.method, msg.pkg.Name)
+	case msg.dryRun:
+		return "[dry-run] " + formatArgv(msg.argv)
+	case msg.err != nil:
+		return fmt.Sprintf("Failed to %s %s: %v", msg.action, msg.pkg.Name, msg.err)
+	case msg.note != "":
+		return fmt.Sprintf("Done: %s %s (%s)", msg.action, msg.pkg.Name, msg.note)
+	default:
+		return fmt.Sprintf("Done: %s %s", msg.action, msg.pkg.Name)
+	}
+}
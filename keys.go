@@ -0,0 +1,292 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// keyMap holds every key of the TUI, so the hints and the help overlay are
+// made from the keys that are actually handled. Keys on letters, like j and
+// k, only work while the list has the focus; typed in the search box, they
+// are text.
+type keyMap struct {
+	// Moving around, in every list
+	Navigate key.Binding // Only a hint for the keys below
+	Up       key.Binding
+	Down     key.Binding
+	PageUp   key.Binding
+	PageDown key.Binding
+	Home     key.Binding
+	End      key.Binding
+	Focus    key.Binding
+	Help     key.Binding
+	Close    key.Binding // Closes what's shown over the list
+	Escape   key.Binding
+	Quit     key.Binding
+
+	// Packages tab
+	Install       key.Binding
+	Remove        key.Binding
+	Versions      key.Binding
+	Dependencies  key.Binding
+	Hold          key.Binding
+	InstallFile   key.Binding
+	FindElsewhere key.Binding
+	Export        key.Binding
+	Sort          key.Binding
+	Reverse       key.Binding
+	Columns       key.Binding
+	Repos         key.Binding
+	Cleanup       key.Binding
+	Usage         key.Binding
+	DryRun        key.Binding
+
+	// Repositories tab
+	ToggleRepo key.Binding
+	RemoveRepo key.Binding
+	AddRepo    key.Binding
+	ReposBack  key.Binding
+
+	// Clean up and disk usage tabs
+	Clean       key.Binding
+	CleanupBack key.Binding
+	UsageBack   key.Binding
+
+	// Versions, dependencies and columns, shown over the list
+	InstallVersion key.Binding
+	Expand         key.Binding
+	Collapse       key.Binding
+	ReverseDeps    key.Binding
+	ToggleColumn   key.Binding
+	MoveColumnUp   key.Binding
+	MoveColumnDown key.Binding
+	Confirm        key.Binding
+}
+
+var keys = keyMap{
+	Navigate: key.NewBinding(key.WithHelp("↑↓/PgUp/PgDn", "Navigate")),
+	Up:       key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "Up")),
+	Down:     key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "Down")),
+	PageUp:   key.NewBinding(key.WithKeys("pgup"), key.WithHelp("PgUp", "Page up")),
+	PageDown: key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("PgDn", "Page down")),
+	Home:     key.NewBinding(key.WithKeys("home", "g"), key.WithHelp("Home/g", "First")),
+	End:      key.NewBinding(key.WithKeys("end", "G"), key.WithHelp("End/G", "Last")),
+	Focus:    key.NewBinding(key.WithKeys("tab"), key.WithHelp("Tab", "Search box/list")),
+	Help:     key.NewBinding(key.WithKeys("?", "f1"), key.WithHelp("?/F1", "Help")),
+	Close:    key.NewBinding(key.WithKeys("esc"), key.WithHelp("Esc", "Back")),
+	Escape:   key.NewBinding(key.WithKeys("esc"), key.WithHelp("Esc", "Back to the list or the search box, or quit")),
+	Quit:     key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("Ctrl+C", "Quit")),
+
+	Install:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("Enter", "Install/Upgrade")),
+	Remove:        key.NewBinding(key.WithKeys("ctrl+x"), key.WithHelp("Ctrl+X", "Remove")),
+	Versions:      key.NewBinding(key.WithKeys("ctrl+v"), key.WithHelp("Ctrl+V", "Versions")),
+	Dependencies:  key.NewBinding(key.WithKeys("ctrl+g"), key.WithHelp("Ctrl+G", "Dependencies")),
+	Hold:          key.NewBinding(key.WithKeys("ctrl+p"), key.WithHelp("Ctrl+P", "Hold")),
+	InstallFile:   key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("Ctrl+O", "Install typed file")),
+	FindElsewhere: key.NewBinding(key.WithKeys("ctrl+f"), key.WithHelp("Ctrl+F", "Find elsewhere")),
+	Export:        key.NewBinding(key.WithKeys("ctrl+e"), key.WithHelp("Ctrl+E", "Export")),
+	Sort:          key.NewBinding(key.WithKeys("ctrl+s"), key.WithHelp("Ctrl+S", "Sort")),
+	Reverse:       key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("Ctrl+R", "Reverse order")),
+	Columns:       key.NewBinding(key.WithKeys("ctrl+k"), key.WithHelp("Ctrl+K", "Columns")),
+	Repos:         key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("Ctrl+T", "Repositories")),
+	Cleanup:       key.NewBinding(key.WithKeys("ctrl+l"), key.WithHelp("Ctrl+L", "Clean up")),
+	Usage:         key.NewBinding(key.WithKeys("ctrl+u"), key.WithHelp("Ctrl+U", "Disk usage")),
+	DryRun:        key.NewBinding(key.WithKeys("ctrl+d"), key.WithHelp("Ctrl+D", "Dry-run")),
+
+	ToggleRepo: key.NewBinding(key.WithKeys("enter"), key.WithHelp("Enter", "Enable/Disable")),
+	RemoveRepo: key.NewBinding(key.WithKeys("ctrl+x"), key.WithHelp("Ctrl+X", "Remove")),
+	AddRepo:    key.NewBinding(key.WithKeys("ctrl+a"), key.WithHelp("Ctrl+A", "Add typed repository")),
+	ReposBack:  key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("Ctrl+T", "Packages")),
+
+	Clean:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("Enter", "Remove/Empty")),
+	CleanupBack: key.NewBinding(key.WithKeys("ctrl+l", "ctrl+t"), key.WithHelp("Ctrl+L", "Packages")),
+	UsageBack:   key.NewBinding(key.WithKeys("ctrl+u", "ctrl+t"), key.WithHelp("Ctrl+U", "Packages")),
+
+	InstallVersion: key.NewBinding(key.WithKeys("enter"), key.WithHelp("Enter", "Install")),
+	Expand:         key.NewBinding(key.WithKeys("right", "enter"), key.WithHelp("Right/Enter", "Expand")),
+	Collapse:       key.NewBinding(key.WithKeys("left"), key.WithHelp("Left", "Collapse")),
+	ReverseDeps:    key.NewBinding(key.WithKeys("tab"), key.WithHelp("Tab", "Dependencies/Dependents")),
+	ToggleColumn:   key.NewBinding(key.WithKeys("enter", " "), key.WithHelp("Enter", "Show/Hide")),
+	MoveColumnUp:   key.NewBinding(key.WithKeys("shift+up"), key.WithHelp("Shift+Up", "Move up")),
+	MoveColumnDown: key.NewBinding(key.WithKeys("shift+down"), key.WithHelp("Shift+Down", "Move down")),
+	Confirm:        key.NewBinding(key.WithKeys("enter"), key.WithHelp("Enter", "Confirm")),
+}
+
+// keyGroup is a section of the help overlay.
+type keyGroup struct {
+	title    string
+	bindings []key.Binding
+}
+
+func (k keyMap) groups() []keyGroup {
+	return []keyGroup{
+		{"Moving around", []key.Binding{k.Up, k.Down, k.PageUp, k.PageDown, k.Home, k.End, k.Focus, k.Help, k.Escape, k.Quit}},
+		{"Packages", []key.Binding{k.Install, k.Remove, k.Versions, k.Dependencies, k.Hold, k.InstallFile, k.FindElsewhere, k.Export, k.Sort, k.Reverse, k.Columns, k.Repos, k.Cleanup, k.Usage, k.DryRun}},
+		{"Repositories", []key.Binding{k.ToggleRepo, k.RemoveRepo, k.AddRepo, k.ReposBack}},
+		{"Clean up", []key.Binding{k.Clean, k.CleanupBack}},
+		{"Versions", []key.Binding{k.InstallVersion}},
+		{"Dependencies", []key.Binding{k.Expand, k.Collapse, k.ReverseDeps}},
+		{"Columns", []key.Binding{k.ToggleColumn, k.MoveColumnUp, k.MoveColumnDown}},
+	}
+}
+
+// hintsOf lays out keys for the command bar: "Ctrl+X: Remove • Esc: Back".
+func hintsOf(bindings ...key.Binding) string {
+	parts := make([]string, len(bindings))
+	for i, b := range bindings {
+		parts[i] = b.Help().Key + ": " + b.Help().Desc
+	}
+	return strings.Join(parts, " • ")
+}
+
+// helpLines lists every key, under a heading per part of the TUI.
+func helpLines() []string {
+	width := 0
+	for _, g := range keys.groups() {
+		for _, b := range g.bindings {
+			width = max(width, ansi.StringWidth(b.Help().Key))
+		}
+	}
+	var lines []string
+	for _, g := range keys.groups() {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, headerStyle.Render(g.title))
+		for _, b := range g.bindings {
+			lines = append(lines, "  "+padRight(b.Help().Key, width)+"  "+b.Help().Desc)
+		}
+	}
+	return lines
+}
+
+// navigate moves the cursor of the list in view, or scrolls the viewport if
+// it shows no list, e.g. the help overlay. It tells whether msg was a key to
+// move around.
+func (m *model) navigate(msg tea.KeyMsg) bool {
+	if m.typing() && (msg.Type == tea.KeyRunes || key.Matches(msg, keys.Home, keys.End)) {
+		return false // Text, or the caret of the search box
+	}
+	if !key.Matches(msg, keys.Up, keys.Down, keys.PageUp, keys.PageDown, keys.Home, keys.End) {
+		return false
+	}
+	cursor, n := m.activeList()
+	if cursor == nil {
+		switch {
+		case key.Matches(msg, keys.Up):
+			m.viewport.ScrollUp(1)
+		case key.Matches(msg, keys.Down):
+			m.viewport.ScrollDown(1)
+		case key.Matches(msg, keys.PageUp):
+			m.viewport.PageUp()
+		case key.Matches(msg, keys.PageDown):
+			m.viewport.PageDown()
+		case key.Matches(msg, keys.Home):
+			m.viewport.GotoTop()
+		case key.Matches(msg, keys.End):
+			m.viewport.GotoBottom()
+		}
+		return true
+	}
+	page := max(m.viewport.Height, 1)
+	switch {
+	case key.Matches(msg, keys.Up):
+		*cursor--
+	case key.Matches(msg, keys.Down):
+		*cursor++
+	case key.Matches(msg, keys.PageUp):
+		*cursor -= page
+	case key.Matches(msg, keys.PageDown):
+		*cursor += page
+	case key.Matches(msg, keys.Home):
+		*cursor = 0
+	case key.Matches(msg, keys.End):
+		*cursor = n - 1
+	}
+	*cursor = max(min(*cursor, n-1), 0)
+	return true
+}
+
+// typing tells whether keys go to the text input rather than to the list.
+// The clean up and disk usage tabs don't use it.
+func (m model) typing() bool {
+	if m.picker != nil || m.deps != nil || m.columnPicker != nil || m.help {
+		return false
+	}
+	return m.textInput.Focused() && (m.tab == packagesTab || m.tab == reposTab)
+}
+
+// activeList returns the cursor of the list in the viewport and its length,
+// or nil if the viewport shows something else.
+func (m *model) activeList() (*int, int) {
+	switch {
+	case m.help, m.impact != nil:
+		return nil, 0
+	case m.picker != nil:
+		return &m.picker.cursor, len(m.picker.versions)
+	case m.deps != nil:
+		return &m.deps.cursor, len(m.deps.rows())
+	case m.columnPicker != nil:
+		return &m.columnPicker.cursor, len(m.columnPicker.ids(m.layout))
+	case m.tab == reposTab:
+		return &m.repoCursor, len(m.repos)
+	case m.tab == cleanupTab:
+		return &m.cleanupAt, len(m.cleanup)
+	case m.tab == usageTab:
+		return nil, 0
+	}
+	return &m.cursor, len(m.filtered)
+}
+
+// The input box takes the first 3 lines of the screen, then a blank line
+// and the top border of the list box.
+const (
+	inputBoxLines = 3
+	listFirstLine = inputBoxLines + 2
+)
+
+// updateMouse scrolls with the wheel, and selects the clicked row, giving
+// the list the focus. Clicking the input box gives it the focus back.
+func (m *model) updateMouse(msg tea.MouseMsg) {
+	if msg.Action != tea.MouseActionPress {
+		return
+	}
+	switch msg.Button {
+	case tea.MouseButtonWheelUp, tea.MouseButtonWheelDown:
+		delta := m.viewport.MouseWheelDelta
+		if msg.Button == tea.MouseButtonWheelUp {
+			delta = -delta
+		}
+		if cursor, n := m.activeList(); cursor != nil {
+			*cursor = max(min(*cursor+delta, n-1), 0)
+		} else if delta < 0 {
+			m.viewport.ScrollUp(-delta)
+		} else {
+			m.viewport.ScrollDown(delta)
+		}
+	case tea.MouseButtonLeft:
+		if msg.Y < inputBoxLines {
+			m.textInput.Focus()
+			return
+		}
+		row := msg.Y - listFirstLine
+		if m.header != "" {
+			row-- // The column titles
+		}
+		cursor, n := m.activeList()
+		if cursor == nil || row < 0 || row >= m.viewport.Height {
+			return
+		}
+		top := m.viewport.YOffset
+		if cursor == &m.cursor {
+			top = m.listTop
+		}
+		if i := top + row; i < n {
+			*cursor = i
+			m.textInput.Blur()
+		}
+	}
+}
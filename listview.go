@@ -0,0 +1,75 @@
+package main
+
+import "strings"
+
+// listRows are the rows of the package list, laid out once for the listed
+// packages and formatted as they're first shown, so that moving through
+// thousands of packages only formats the few in view. They're dropped
+// (set to nil) whenever the packages, their state or the columns change.
+type listRows struct {
+	width  int // Of the viewport they were laid out for
+	cols   []column
+	widths []int
+	header string
+	lines  []string // "" until shown
+}
+
+func newListRows(l listLayout, pkgs []Package, width int) *listRows {
+	cols := l.shown()
+	widths := l.columnWidths(cols, pkgs, max(width, 40))
+	cells := make([]string, len(cols))
+	for j, c := range cols {
+		cells[j] = l.title(c)
+	}
+	return &listRows{
+		width:  width,
+		cols:   cols,
+		widths: widths,
+		header: formatRow(cols, widths, cells),
+		lines:  make([]string, len(pkgs)),
+	}
+}
+
+// line returns the formatted row of pkgs[i], cut to the viewport.
+func (r *listRows) line(pkgs []Package, i int) string {
+	if r.lines[i] == "" {
+		cells := make([]string, len(r.cols))
+		for j, c := range r.cols {
+			cells[j] = c.value(pkgs[i])
+		}
+		r.lines[i] = formatRow(r.cols, r.widths, cells)
+		if r.width > 0 {
+			r.lines[i] = truncate(r.lines[i], r.width)
+		}
+	}
+	return r.lines[i]
+}
+
+// renderList fills the viewport with the packages in view, scrolled to keep
+// the cursor shown.
+func (m *model) renderList() {
+	if m.rows == nil || m.rows.width != m.viewport.Width {
+		m.rows = newListRows(m.layout, m.filtered, m.viewport.Width)
+	}
+	m.header = headerStyle.Render(m.row(m.rows.header, false))
+
+	height := max(m.viewport.Height, 1)
+	if m.cursor < m.listTop {
+		m.listTop = m.cursor
+	} else if m.cursor >= m.listTop+height {
+		m.listTop = m.cursor - height + 1
+	}
+	m.listTop = max(min(m.listTop, len(m.filtered)-height), 0)
+
+	end := min(m.listTop+height, len(m.filtered))
+	lines := make([]string, 0, end-m.listTop)
+	for i := m.listTop; i < end; i++ {
+		line := m.rows.line(m.filtered, i)
+		if i == m.cursor {
+			line = m.row(line, true)
+		}
+		lines = append(lines, line)
+	}
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+	m.viewport.SetYOffset(0)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// BenchmarkView moves the cursor through 50k packages and renders the list,
+// which only formats the rows in view.
+func BenchmarkView(b *testing.B) {
+	b.Setenv("XDG_CONFIG_HOME", b.TempDir())
+	pkgs := make([]Package, 50000)
+	for i := range pkgs {
+		pkgs[i] = Package{
+			Name:        fmt.Sprintf("package-%05d", i),
+			Manager:     "apt/dpkg",
+			Version:     fmt.Sprintf("1.%d.%d-1", i%100, i%7),
+			Size:        int64(i) * 1024,
+			IsInstalled: i%3 != 0,
+			Held:        i%50 == 0,
+		}
+	}
+	r := fixtureRunner{dir: "testdata/fixtures/ubuntu"}
+	next, _ := initialModel(r, nil, nil, pkgs, "").Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m, _ := update(next.(model), tea.KeyMsg{Type: tea.KeyTab})
+
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next, _ := m.Update(down)
+		m = next.(model)
+		if m.cursor == len(pkgs)-1 {
+			m.cursor = 0
+		}
+		_ = m.View()
+	}
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 
@@ -13,53 +12,90 @@ import (
 )
 
 type Package struct {
-	Name        string
-	Manager     string
-	Version     string
-	IsInstalled bool
+	Name        string `json:"name"`
+	Manager     string `json:"manager"`
+	Version     string `json:"version"`
+	IsInstalled bool   `json:"installed"`
+	Origin      string `json:"origin,omitempty"`     // Remote or repository it came from, where known
+	Held        bool   `json:"held,omitempty"`       // Kept at its version by upgrades
+	OwnHold     bool   `json:"-"`                    // Held in holds.json only, so only by lazyinstaller's upgrades
+	Size        int64  `json:"size,omitempty"`       // Installed size in bytes, where known
+	Dependency  bool   `json:"dependency,omitempty"` // Installed only because other packages need it
+	Upgrade     string `json:"upgrade,omitempty"`    // Version an upgrade would install, once checked
 }
 
-func executeCommand(template string, pkgName string) {
-	if template == "" {
-		fmt.Println("Command not defined for this package manager.")
-		return
+// expandCommand fills the package name into a command template.
+// If the template ends with ".x", "#x" or " x", the "x" is replaced by pkgName.
+func expandCommand(template string, pkgName string) string {
+	if strings.HasSuffix(template, ".x") || strings.HasSuffix(template, "#x") || strings.HasSuffix(template, " x") {
+		return strings.TrimSuffix(template, "x") + pkgName
 	}
+	return template
+}
+
+// dryRun makes executeCommand and the TUI jobs print the commands they
+// would run instead of running them.
+var dryRun bool
+
+// showRuntimes lists the flatpak runtimes along with the applications.
+var showRuntimes bool
 
-	cmdStr := template
-	// if template ends with ".x" or " x" remove "x" and add pkgName
-	if strings.HasSuffix(template, ".x") || strings.HasSuffix(template, " x") {
-		cmdStr = strings.TrimSuffix(template, "x") + pkgName
+// commandArgv returns the argv of a command template filled with pkgName.
+func commandArgv(template string, pkgName string) []string {
+	return strings.Fields(expandCommand(template, pkgName))
+}
+
+// formatArgv quotes the arguments that a shell would split or expand, so the
+// printed command can be copied as is.
+func formatArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
 	}
+	return strings.Join(quoted, " ")
+}
+
+func executeCommand(r Runner, template string, pkgName string) error {
+	if template == "" {
+		return errors.New("command not defined for this package manager")
+	}
+
+	return executeArgv(r, commandArgv(template, pkgName))
+}
 
-	parts := strings.Fields(cmdStr)
+// executeArgv runs a command, or prints it in dry-run mode.
+func executeArgv(r Runner, parts []string) error {
 	if len(parts) == 0 {
-		return
+		return nil
+	}
+
+	if dryRun {
+		fmt.Println("[dry-run] " + formatArgv(parts))
+		return nil
 	}
 
 	head := parts[0]
 	args := parts[1:]
 
-	cmd := exec.Command(head, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err != nil {
-		// todo : status bar
-		// fmt.Printf("Error executing command: %v\n", err)
-		os.Exit(1)
-	}
+	return r.Command(context.Background(), head, args...).Run()
 }
 
 func main() {
 	const version = "25.12.20"
 
+	runner := newRunner()
+
 	if len(os.Args) > 1 {
 		// parse arguments
 		args := os.Args[1:]
 		for i := range args {
 			arg := args[i]
+			if globalFlag(arg) {
+				continue
+			}
 			if strings.HasPrefix(arg, "-") {
 				switch arg {
 				case "--help", "-h":
@@ -77,13 +113,37 @@ func main() {
 				case "version", "ver":
 					fmt.Printf("lazyinstaller v%v\n", version)
 					return
+				case "apply":
+					if err := runApply(runner, args[i+1:]); err != nil {
+						fmt.Fprintf(os.Stderr, "apply: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				case "install":
+					if err := runInstall(runner, args[i+1:]); err != nil {
+						fmt.Fprintf(os.Stderr, "install: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				case "upgrade":
+					if err := runUpgrade(runner, args[i+1:]); err != nil {
+						fmt.Fprintf(os.Stderr, "upgrade: %v\n", err)
+						os.Exit(1)
+					}
+					return
+				case "export":
+					if err := runExport(runner, args[i+1:]); err != nil {
+						fmt.Fprintf(os.Stderr, "export: %v\n", err)
+						os.Exit(1)
+					}
+					return
 				}
 			}
 		}
 	}
 
 	// Detect OS and PM
-	pms := detectPM()
+	pms := detectPM(runner)
 
 	// switch action {
 	// case "pmlist":
@@ -179,309 +239,75 @@ func main() {
 	// 	fmt.Printf("'%v' sub-command is not supported.\n", action)
 	// }
 
-	status := ""
-
-	pkgs := []Package{}
-
-	scannedPMs := make(map[string]struct{}, len(pms))
-
-	// Parse packages
-	for _, p := range pms {
-		switch p.Name {
-		case "apt", "dpkg", "dpkg-query":
-			if _, exists := scannedPMs["apt"]; exists {
-				continue
-			}
-
-			scannedPMs["apt"] = struct{}{}
-			scannedPMs["dpkg"] = struct{}{}
-			scannedPMs["dpkg-query"] = struct{}{}
-
-			// 1. Get APT/DPKG packages
-			// Using -W and -f for clean "name,version" output
-			cmdDpkg := exec.Command("dpkg-query", "-W", "-f=${binary:Package},${Version}\n")
-			outDpkg, err := cmdDpkg.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outDpkg)))
-				for scanner.Scan() {
-					line := scanner.Text()
-					parts := strings.Split(line, ",")
-					if len(parts) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        parts[0],
-							Version:     parts[1],
-							Manager:     "apt/dpkg",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got APT/DPKG packages"
-			} else {
-				status = "Failed to get APT/DPKG packages"
-			}
-		case "snap":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 2. Get Snap packages
-			cmdSnap := exec.Command("snap", "list")
-			outSnap, err := cmdSnap.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outSnap)))
-				scanner.Scan() // Skip header: "Name  Version  Rev..."
-				for scanner.Scan() {
-					fields := strings.Fields(scanner.Text())
-					if len(fields) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        fields[0],
-							Version:     fields[1],
-							Manager:     "snap",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got Snap packages"
-			} else {
-				status = "Failed to get Snap packages"
-			}
-		case "flatpak":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 3. Get Flatpak packages
-			// --app limits to applications (hiding runtimes)
-			// --columns formats output
-			cmdFlatpak := exec.Command("flatpak", "list", "--app", "--columns=application,version")
-			outFlatpak, err := cmdFlatpak.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outFlatpak)))
-				for scanner.Scan() {
-					fields := strings.Fields(scanner.Text())
-					if len(fields) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        fields[0],
-							Version:     fields[1],
-							Manager:     "flatpak",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got Flatpak packages"
-			} else {
-				status = "Failed to get Flatpak packages"
-			}
-		case "pacman":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 4. Get Pacman packages (Arch Linux)
-			cmdPacman := exec.Command("pacman", "-Q")
-			outPacman, err := cmdPacman.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outPacman)))
-				for scanner.Scan() {
-					// Output format: "name version" (e.g., "firefox 112.0.1-1")
-					fields := strings.Fields(scanner.Text())
-					if len(fields) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        fields[0],
-							Version:     fields[1],
-							Manager:     "pacman",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got Pacman packages"
-			} else {
-				status = "Failed to get Pacman packages"
-			}
-		case "nix-env":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 5. Get Nix user-profile packages
-			cmdNix := exec.Command("nix-env", "-q")
-			outNix, err := cmdNix.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outNix)))
-				for scanner.Scan() {
-					line := scanner.Text()
-					// Nix output format is usually "name-version"
-					// Finding the last hyphen helps separate version from name
-					lastHyphen := strings.LastIndex(line, "-")
-					if lastHyphen != -1 {
-						name := line[:lastHyphen]
-						version := line[lastHyphen+1:]
-
-						// Optional: check if version starts with a digit to confirm split
-						if len(version) > 0 && (version[0] >= '0' && version[0] <= '9') {
-							pkgs = append(pkgs, Package{
-								Name:        name,
-								Version:     version,
-								Manager:     "nix-env",
-								IsInstalled: true,
-							})
-						} else {
-							// Fallback if no clear version number
-							pkgs = append(pkgs, Package{
-								Name:        line,
-								Version:     "unknown",
-								Manager:     "nix-user",
-								IsInstalled: true,
-							})
-						}
-					}
-				}
-				status = "Successfully got Nix packages"
-			} else {
-				status = "Failed to get Nix packages"
-			}
-		case "brew":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 6. Get Nix user-profile packages
-			cmd := exec.Command("brew", "list", "--versions")
-			out, err := cmd.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(out)))
-				for scanner.Scan() {
-					// Output lines: "readline 8.2.1" or "python@3.11 3.11.3"
-					fields := strings.Fields(scanner.Text())
-					if len(fields) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        fields[0],
-							Version:     fields[1],
-							Manager:     "brew",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got Homebrew packages"
-			} else {
-				status = "Failed to get Homebrew packages"
-			}
-		case "port":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 7. Get MacPorts packages
-			// "active" ensures we only get the currently linked version
-			cmdPort := exec.Command("port", "installed", "active")
-			outPort, err := cmdPort.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outPort)))
-				// Skip the first line: "The following ports are currently installed:"
-				if scanner.Scan() {
-					_ = scanner.Text()
-				}
-
-				for scanner.Scan() {
-					line := strings.TrimSpace(scanner.Text())
-					if line == "" {
-						continue
-					}
+	pkgs, status := scanPackages(runner, pms)
 
-					// Line format: "name @version_variant (active)"
-					// Example: "curl @8.4.0_0+ssl (active)"
-					parts := strings.Fields(line)
-					if len(parts) >= 2 {
-						name := parts[0]
-						// Version is parts[1], usually starting with '@'
-						version := strings.TrimPrefix(parts[1], "@")
-
-						pkgs = append(pkgs, Package{
-							Name:        name,
-							Version:     version,
-							Manager:     "macports",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got MacPorts packages"
-			} else {
-				status = "Failed to get MacPorts packages"
-			}
-		case "dnf", "rpm":
-			if _, exists := scannedPMs["dnf"]; exists {
-				continue
-			}
-			scannedPMs["dnf"] = struct{}{}
-			scannedPMs["rpm"] = struct{}{}
-			// 8. Get RPM packages (Direct DB access)
-			// Use --qf to output "name version-release" directly
-			cmdRpm := exec.Command("rpm", "-qa", "--qf", "%{NAME} %{VERSION}-%{RELEASE}\n")
-			outRpm, err := cmdRpm.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outRpm)))
-				for scanner.Scan() {
-					line := scanner.Text()
-					parts := strings.Fields(line)
-					if len(parts) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        parts[0],
-							Version:     parts[1],
-							Manager:     "rpm/dnf",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got RPM packages"
-			} else {
-				status = "Failed to get RPM packages"
-			}
-		case "guix":
-			if _, exists := scannedPMs[p.Name]; exists {
-				continue
-			}
-			scannedPMs[p.Name] = struct{}{}
-			// 9. Get Guix packages
-			cmdGuix := exec.Command("guix", "package", "-I")
-			outGuix, err := cmdGuix.Output()
-			if err == nil {
-				scanner := bufio.NewScanner(strings.NewReader(string(outGuix)))
-				for scanner.Scan() {
-					line := scanner.Text()
-					parts := strings.Fields(line)
-					if len(parts) >= 2 {
-						pkgs = append(pkgs, Package{
-							Name:        parts[0],
-							Version:     parts[1],
-							Manager:     "guix",
-							IsInstalled: true,
-						})
-					}
-				}
-				status = "Successfully got Guix packages"
-			} else {
-				status = "Failed to get Guix packages"
-			}
-		default:
-			status = "Unsupported package manager"
-			continue
+	var pk *packageKitClient
+	if usePackageKit {
+		var err error
+		if pk, err = newPackageKitClient(); err != nil {
+			status = "PackageKit is not available, using commands: " + err.Error()
+		} else {
+			defer pk.Close()
 		}
 	}
 
-	p := tea.NewProgram(initialModel(pkgs, status), tea.WithAltScreen())
+	p := tea.NewProgram(initialModel(runner, pk, pms, pkgs, status), tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Alas, there's been an error: %v", err)
 		os.Exit(1)
 	}
 }
 
+// globalFlag sets the flags that apply to every sub-command, given before
+// or after it, and tells whether arg was one of them.
+func globalFlag(arg string) bool {
+	switch arg {
+	case "--dry-run", "-n":
+		dryRun = true
+	case "--packagekit":
+		usePackageKit = true
+	case "--runtimes":
+		showRuntimes = true
+	default:
+		return false
+	}
+	return true
+}
+
 func printUsage(version string) {
 	fmt.Printf("lazyinstaller v%v\nthe tool to manage all programs, apps, and packages installed via all available package managers\n", version)
+	fmt.Print(`
+Usage:
+  lazyinstaller [--dry-run]     open the terminal user interface
+      -n, --dry-run               print the commands instead of running them (all sub-commands)
+      --packagekit                search, install and remove system packages through PackageKit
+                                  (polkit instead of sudo)
+      --runtimes                  also list flatpak runtimes (all sub-commands)
+  lazyinstaller export [flags]  export the installed packages inventory
+      -f, --format json|csv|yaml|lazyfile
+                                  output format (default: from file extension, else json)
+      -o, --output FILE           write to FILE instead of stdout
+      --to MANAGER                rename packages to their names in MANAGER where known
+  lazyinstaller apply [FILE] [flags]
+                                install the packages listed in FILE (default: Lazyfile)
+      --prune                     also remove packages missing from FILE, for the managers it lists
+                                  (except held packages and dependencies)
+      -y, --yes                   don't ask for confirmation
+  lazyinstaller install FILE [flags]
+                                install a local package file (.deb, .rpm, .pkg.tar.zst, .flatpakref
+                                or .snap) with the package manager for it, after showing its metadata
+      --devmode                   install a snap without confinement
+      --user                      install a .flatpakref into the per-user installation
+      -y, --yes                   don't ask for confirmation
+  lazyinstaller upgrade         upgrade the packages of every package manager, except held ones
+  lazyinstaller help            show this help
+  lazyinstaller version         show the version
+`)
 }
 
-func isInstalled(pkg string) (bool, string) {
-	path, err := exec.LookPath(pkg)
-	if errors.Is(err, exec.ErrNotFound) {
+func isInstalled(r Runner, pkg string) (bool, string) {
+	path, err := r.LookPath(pkg)
+	if err != nil {
 		return false, ""
 	}
 	return true, path
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A Lazyfile is a portable list of packages per package manager:
+//
+//	# comments start with '#'
+//	[apt]
+//	git
+//	curl = 8.5.0-2ubuntu10
+//
+//	[brew]
+//	fd
+//
+// Section names are pm_commands keys. A version after '=' pins the package
+// to that version where the manager supports it.
+const defaultManifest = "Lazyfile"
+
+type manifestEntry struct {
+	Manager string
+	Name    string
+	Version string
+}
+
+func parseManifest(r io.Reader) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	manager := ""
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section %q", lineNo, line)
+			}
+			manager = managerKey(strings.TrimSpace(line[1 : len(line)-1]))
+			if _, ok := pm_commands[manager]; !ok {
+				return nil, fmt.Errorf("line %d: unsupported package manager %q", lineNo, manager)
+			}
+			continue
+		}
+
+		if manager == "" {
+			return nil, fmt.Errorf("line %d: package %q is not under a [manager] section", lineNo, line)
+		}
+
+		name, version, _ := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		version = strings.TrimSpace(version)
+		if !validManifestName(manager, name) {
+			return nil, fmt.Errorf("line %d: invalid package name %q", lineNo, name)
+		}
+		if strings.ContainsAny(version, " \t") || strings.HasPrefix(version, "-") {
+			return nil, fmt.Errorf("line %d: invalid version %q", lineNo, version)
+		}
+		entries = append(entries, manifestEntry{
+			Manager: manager,
+			Name:    name,
+			Version: version,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// loadManifest reads a Lazyfile, or a JSON inventory written by `export`.
+func loadManifest(path string) ([]manifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".json") {
+		return parseManifest(f)
+	}
+
+	var inv inventory
+	if err := json.NewDecoder(f).Decode(&inv); err != nil {
+		return nil, err
+	}
+	entries := make([]manifestEntry, 0, len(inv.Packages))
+	for _, p := range inv.Packages {
+		if !p.IsInstalled {
+			continue
+		}
+		manager := managerKey(p.Manager)
+		if !validManifestName(manager, p.Name) {
+			return nil, fmt.Errorf("invalid package name %q", p.Name)
+		}
+		entries = append(entries, manifestEntry{Manager: manager, Name: p.Name})
+	}
+	return entries, nil
+}
+
+var archPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// validManifestName accepts the names validateInput does and, for apt, the
+// ":arch" dpkg qualifies some multiarch packages with, as exported.
+func validManifestName(manager, name string) bool {
+	if base, arch, ok := strings.Cut(name, ":"); ok && manager == "apt" {
+		return validateInput(base) && archPattern.MatchString(arch)
+	}
+	return validateInput(name)
+}
+
+type planAction string
+
+const (
+	planInstall planAction = "+"
+	planPin     planAction = "~"
+	planRemove  planAction = "-"
+)
+
+type planStep struct {
+	Action  planAction
+	Manager string
+	Name    string
+	Version string // wanted version, if pinned
+	Current string // installed version, if any
+	Command string // command template, empty if the manager can't do it
+	Spec    string // what is filled into the template
+	Note    string
+}
+
+func (s planStep) commandLine() string {
+	return expandCommand(s.Command, s.Spec)
+}
+
+// remapEntries moves entries of managers that aren't available here to the
+// first available manager that has a mapping for the package, e.g. a brew
+// "fd" becomes an apt "fd-find" on Ubuntu. available is in preference order.
+func remapEntries(entries []manifestEntry, available []string, pkgMap *packageMap) ([]manifestEntry, []string) {
+	have := make(map[string]bool, len(available))
+	for _, mgr := range available {
+		have[mgr] = true
+	}
+
+	var notes []string
+	remapped := make([]manifestEntry, 0, len(entries))
+	for _, e := range entries {
+		if !have[e.Manager] {
+			for _, mgr := range available {
+				if name, ok := pkgMap.translate(e.Name, e.Manager, mgr); ok {
+					notes = append(notes, fmt.Sprintf("%s %s -> %s %s", e.Manager, e.Name, mgr, name))
+					e = manifestEntry{Manager: mgr, Name: name}
+					break
+				}
+			}
+		}
+		remapped = append(remapped, e)
+	}
+	return remapped, notes
+}
+
+// availableManagers returns the pm_commands keys of the detected managers,
+// in detection order.
+func availableManagers(pms []packageManager) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, p := range pms {
+		key := managerKey(p.Name)
+		if _, ok := pm_commands[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// planManifest compares the manifest against the installed packages. The
+// installed packages of the managers in prune that are not in the manifest
+// are planned for removal, except the held ones and the ones installed as
+// dependencies, which go with what needs them. Entries of managers missing
+// from available are reported but skipped; a nil available allows all.
+func planManifest(entries []manifestEntry, installed []Package, available []string, prune []string) []planStep {
+	have := make(map[string]bool, len(available))
+	for _, mgr := range available {
+		have[mgr] = true
+	}
+
+	current := make(map[string]Package, len(installed))
+	for _, p := range installed {
+		if p.IsInstalled {
+			current[managerKey(p.Manager)+"\x00"+p.Name] = p
+		}
+	}
+
+	var steps []planStep
+	wanted := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		key := e.Manager + "\x00" + e.Name
+		wanted[key] = true
+		cmds := pm_commands[e.Manager]
+
+		p, ok := current[key]
+		switch {
+		case available != nil && !have[e.Manager]:
+			steps = append(steps, planStep{
+				Action:  planInstall,
+				Manager: e.Manager,
+				Name:    e.Name,
+				Version: e.Version,
+				Note:    e.Manager + " is not available on this machine, skipped",
+			})
+		case !ok:
+			steps = append(steps, installStep(planInstall, e, "", cmds))
+		case e.Version != "" && p.Version != e.Version:
+			steps = append(steps, installStep(planPin, e, p.Version, cmds))
+		}
+	}
+
+	if len(prune) > 0 {
+		var extras []Package
+		for key, p := range current {
+			if slices.Contains(prune, managerKey(p.Manager)) && !wanted[key] && !p.Held && !p.Dependency {
+				extras = append(extras, p)
+			}
+		}
+		sort.Slice(extras, func(i, j int) bool {
+			if extras[i].Manager != extras[j].Manager {
+				return extras[i].Manager < extras[j].Manager
+			}
+			return extras[i].Name < extras[j].Name
+		})
+		for _, p := range extras {
+			manager := managerKey(p.Manager)
+			step := planStep{Action: planRemove, Manager: manager, Name: p.Name, Current: p.Version}
+			step.Command, step.Spec = pm_commands[manager].Uninstall, p.Name
+			steps = append(steps, step)
+		}
+	}
+
+	return steps
+}
+
+func installStep(action planAction, e manifestEntry, current string, cmds commands) planStep {
+	step := planStep{Action: action, Manager: e.Manager, Name: e.Name, Version: e.Version, Current: current}
+	if cmds.Install == "" {
+		return step
+	}
+	spec, ok := versionedName(e.Manager, e.Name, e.Version)
+	if !ok {
+		if action == planPin {
+			step.Note = "version pinning is not supported by " + e.Manager
+			return step
+		}
+		spec = e.Name
+		step.Note = "version pinning is not supported by " + e.Manager + ", installing the latest"
+	}
+	step.Command, step.Spec = cmds.Install, spec
+	return step
+}
+
+// confineSnapSteps adds the confinement flag to the snaps to install that
+// are not strictly confined, and notes it in the plan.
+func confineSnapSteps(ctx context.Context, r Runner, steps []planStep) {
+	client := newSnapdClient(r)
+	for i, s := range steps {
+		if managerKey(s.Manager) != "snap" || s.Action != planInstall || s.Command == "" {
+			continue
+		}
+		confinement, err := client.confinement(ctx, s.Name, "")
+		if err != nil {
+			continue // snapd will tell if it needs classic confinement
+		}
+		if flag := snapConfinementFlag(confinement); flag != "" {
+			steps[i].Spec += " " + flag
+			steps[i].Note = confinement + " confinement, not sandboxed"
+		}
+	}
+}
+
+func printPlan(w io.Writer, steps []planStep) {
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "Nothing to do, all packages are in place.")
+		return
+	}
+	for _, s := range steps {
+		switch s.Action {
+		case planPin:
+			fmt.Fprintf(w, "%s %-8s %s %s -> %s\n", s.Action, s.Manager, s.Name, s.Current, s.Version)
+		default:
+			version := s.Version
+			if version == "" {
+				version = s.Current
+			}
+			fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("%s %-8s %s %s", s.Action, s.Manager, s.Name, version)))
+		}
+		if s.Command != "" {
+			fmt.Fprintf(w, "    $ %s\n", s.commandLine())
+		} else if s.Note == "" {
+			fmt.Fprintf(w, "    (no command defined for %s, skipped)\n", s.Manager)
+		}
+		if s.Note != "" {
+			fmt.Fprintf(w, "    (%s)\n", s.Note)
+		}
+	}
+}
+
+// planApply plans a manifest on this machine. Entries of managers missing
+// here are remapped to the ones available, but only the managers the
+// manifest lists itself are pruned: a [brew] section remapped to apt doesn't
+// make the rest of the apt packages extras. pkgMap may be nil.
+func planApply(r Runner, entries []manifestEntry, pkgMap *packageMap, prune bool) ([]planStep, []string) {
+	pms := detectPM(r)
+	available := availableManagers(pms)
+
+	var pruned []string
+	if prune {
+		for _, e := range entries {
+			if !slices.Contains(pruned, e.Manager) {
+				pruned = append(pruned, e.Manager)
+			}
+		}
+	}
+	var notes []string
+	if pkgMap != nil {
+		entries, notes = remapEntries(entries, available, pkgMap)
+	}
+
+	installed, _ := scanPackages(r, pms)
+	steps := planManifest(entries, installed, available, pruned)
+	confineSnapSteps(context.Background(), r, steps)
+	previewRemovalSteps(context.Background(), r, steps)
+	return steps, notes
+}
+
+// runApply implements `lazyinstaller apply [file] [--prune] [--dry-run] [--yes]`.
+// With --dry-run the plan is printed and nothing runs.
+func runApply(r Runner, args []string) error {
+	path := defaultManifest
+	prune, yes := false, false
+	for _, arg := range args {
+		if globalFlag(arg) {
+			continue
+		}
+		switch arg {
+		case "--prune":
+			prune = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown argument %q", arg)
+			}
+			path = arg
+		}
+	}
+
+	entries, err := loadManifest(path)
+	if err != nil {
+		return err
+	}
+
+	pkgMap, err := loadPackageMap()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mappings: %v\n", err)
+	}
+	steps, notes := planApply(r, entries, pkgMap, prune)
+	for _, note := range notes {
+		fmt.Println("mapped " + note)
+	}
+
+	printPlan(os.Stdout, steps)
+	if len(steps) == 0 || dryRun {
+		return nil
+	}
+
+	if !yes {
+		fmt.Printf("\nApply %d changes? [y/N] ", len(steps))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return errors.New("aborted")
+		}
+	}
+
+	failed := 0
+	for _, s := range steps {
+		if s.Command == "" {
+			continue
+		}
+		fmt.Printf("\n$ %s\n", s.commandLine())
+		if err := executeCommand(r, s.Command, s.Spec); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", s.Manager, s.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes failed", failed, len(steps))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlanApplyPrune(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	pkgMap, err := loadPackageMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := fixtureRunner{dir: "testdata/fixtures/ubuntu"}
+
+	tests := []struct {
+		name     string
+		manifest string
+		installs []string
+		removals []string
+	}{
+		{
+			// brew is missing, so fd is remapped to apt, which isn't pruned
+			name:     "remapped section",
+			manifest: "[brew]\nfd\n",
+			installs: []string{"apt fd-find"},
+		},
+		{
+			// libc6 and fonts-noto-cjk are dependencies, the kernel is held
+			name:     "dependencies and holds",
+			manifest: "[apt]\nadduser\n",
+		},
+		{
+			name:     "listed manager",
+			manifest: "[snap]\nfirefox\n",
+			removals: []string{"snap code"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseManifest(strings.NewReader(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			steps, _ := planApply(r, entries, pkgMap, true)
+			var installs, removals []string
+			for _, s := range steps {
+				if s.Action == planRemove {
+					removals = append(removals, s.Manager+" "+s.Name)
+				} else {
+					installs = append(installs, s.Manager+" "+s.Name)
+				}
+			}
+			if !slices.Equal(installs, tt.installs) {
+				t.Errorf("installs = %q, want %q", installs, tt.installs)
+			}
+			if !slices.Equal(removals, tt.removals) {
+				t.Errorf("removals = %q, want %q", removals, tt.removals)
+			}
+		})
+	}
+}
+
+// An exported inventory applied back to the same machine changes nothing.
+func TestExportApplyRoundTrip(t *testing.T) {
+	dirs, err := filepath.Glob("testdata/fixtures/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		r := fixtureRunner{dir: dir}
+		pkgs, _ := scanPackages(r, detectPM(r))
+		for _, format := range []string{"lazyfile", "json"} {
+			t.Run(filepath.Base(dir)+"/"+format, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "inventory."+format)
+				if err := writeInventoryFile(path, newInventory(pkgs), format); err != nil {
+					t.Fatal(err)
+				}
+				entries, err := loadManifest(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if steps, _ := planApply(r, entries, nil, true); len(steps) > 0 {
+					t.Errorf("plan = %+v, want no steps", steps)
+				}
+			})
+		}
+	}
+}
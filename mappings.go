@@ -0,0 +1,150 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The mapping database translates package names between managers, e.g. the
+// "fd" tool is "fd-find" in apt and dnf but "fd" in brew. Each entry maps a
+// canonical name to the name used by each manager (pm_commands keys).
+//
+// Users can add or override entries in <config dir>/lazyinstaller/mappings.json,
+// which uses the same format as the embedded mappings.json.
+//
+//go:embed mappings.json
+var embeddedMappings []byte
+
+type packageMap struct {
+	names map[string]map[string]string // canonical -> manager -> name
+	index map[string]string            // manager + "\x00" + name -> canonical
+}
+
+func newPackageMap() *packageMap {
+	return &packageMap{
+		names: make(map[string]map[string]string),
+		index: make(map[string]string),
+	}
+}
+
+// loadPackageMap returns the embedded mappings merged with the user's file.
+// A broken user file is reported, but the embedded mappings are still usable.
+func loadPackageMap() (*packageMap, error) {
+	m := newPackageMap()
+	if err := m.merge(embeddedMappings); err != nil {
+		return nil, fmt.Errorf("embedded mappings: %w", err)
+	}
+
+	path, err := configPath("mappings.json")
+	if err != nil {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := m.merge(data); err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *packageMap) merge(data []byte) error {
+	var entries map[string]map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	// Names end up in commands, so they're checked like a Lazyfile's
+	for canonical, byManager := range entries {
+		for manager, name := range byManager {
+			if !validManifestName(mappingKey(manager), name) {
+				return fmt.Errorf("%s: invalid %s package name %q", canonical, manager, name)
+			}
+		}
+	}
+	for canonical, byManager := range entries {
+		names, ok := m.names[canonical]
+		if !ok {
+			names = make(map[string]string, len(byManager))
+			m.names[canonical] = names
+		}
+		for manager, name := range byManager {
+			manager = mappingKey(manager)
+			if old, ok := names[manager]; ok {
+				delete(m.index, manager+"\x00"+old)
+			}
+			names[manager] = name
+			m.index[manager+"\x00"+name] = canonical
+		}
+	}
+	return nil
+}
+
+// canonical returns the canonical name of a package, falling back to the
+// package name itself.
+func (m *packageMap) canonical(name, manager string) (string, bool) {
+	if c, ok := m.index[mappingKey(manager)+"\x00"+name]; ok {
+		return c, true
+	}
+	if _, ok := m.names[name]; ok {
+		return name, true
+	}
+	return name, false
+}
+
+// translate returns the name of a package of one manager in another manager.
+// Without a mapping, it returns the same name and false.
+func (m *packageMap) translate(name, from, to string) (string, bool) {
+	c, ok := m.canonical(name, from)
+	if !ok {
+		return name, false
+	}
+	if n, ok := m.names[c][mappingKey(to)]; ok {
+		return n, true
+	}
+	return name, false
+}
+
+// alternatives lists the names of a package in every other manager that has
+// a mapping for it, sorted by manager.
+func (m *packageMap) alternatives(name, manager string) []manifestEntry {
+	c, ok := m.canonical(name, manager)
+	if !ok {
+		return nil
+	}
+	from := mappingKey(manager)
+	var alts []manifestEntry
+	for mgr, n := range m.names[c] {
+		if mgr != from {
+			alts = append(alts, manifestEntry{Manager: mgr, Name: n})
+		}
+	}
+	sort.Slice(alts, func(i, j int) bool { return alts[i].Manager < alts[j].Manager })
+	return alts
+}
+
+// mappingKey is the manager key mappings are stored under. Both flatpak
+// installations share the flatpak names.
+func mappingKey(manager string) string {
+	if key := managerKey(manager); key != "flatpak-user" {
+		return key
+	}
+	return "flatpak"
+}
+
+func formatAlternatives(alts []manifestEntry) string {
+	parts := make([]string, len(alts))
+	for i, a := range alts {
+		parts[i] = a.Manager + ": " + a.Name
+	}
+	return strings.Join(parts, ", ")
+}
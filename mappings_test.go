@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeUserMappings(t *testing.T, data string) {
+	t.Helper()
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	if err := os.MkdirAll(filepath.Join(config, "lazyinstaller"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config, "lazyinstaller", "mappings.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	writeUserMappings(t, `{"bat": {"apt": "bat", "nix-profile": "bat", "dnf": "bat"}, "fd": {"dnf": "fd"}}`)
+	pkgMap, err := loadPackageMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, from, to string
+		want           string
+		ok             bool
+	}{
+		{"fd-find", "apt/dpkg", "nix-profile", "fd", true},
+		{"ripgrep", "nix", "brew", "ripgrep", true},
+		{"python3", "nix-profile", "pacman", "python", true},
+		// Both flatpak installations share the names
+		{"com.visualstudio.code", "flatpak-user", "snap", "code", true},
+		// From the user's file, which overrides the embedded entry
+		{"bat", "apt/dpkg", "nix-profile", "bat", true},
+		{"fd-find", "apt/dpkg", "dnf", "fd", true},
+		{"unknown-tool", "apt/dpkg", "dnf", "unknown-tool", false},
+	}
+	for _, tt := range tests {
+		got, ok := pkgMap.translate(tt.name, tt.from, tt.to)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("translate(%s, %s, %s) = %s, %v, want %s, %v", tt.name, tt.from, tt.to, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// Names of the user's mappings end up in commands, so they're checked like
+// those of a Lazyfile; the embedded mappings are still usable.
+func TestUserMappingsValidated(t *testing.T) {
+	for _, data := range []string{
+		`{"fd": {"apt": "fd-find; rm -rf ~"}}`,
+		`{"fd": {"dnf": ""}}`,
+		`{"fd": {"dnf": "fd:amd64"}}`, // Only apt names have an arch
+	} {
+		writeUserMappings(t, data)
+		pkgMap, err := loadPackageMap()
+		if err == nil {
+			t.Errorf("%s: loaded without an error", data)
+			continue
+		}
+		if got, _ := pkgMap.translate("fd-find", "apt", "brew"); got != "fd" {
+			t.Errorf("%s: the embedded mappings translate fd-find to %s", data, got)
+		}
+	}
+
+	writeUserMappings(t, `{"libfoo": {"apt": "libfoo1:i386", "dnf": "libfoo.i686"}}`)
+	if _, err := loadPackageMap(); err != nil {
+		t.Errorf("an apt arch was refused: %v", err)
+	}
+}
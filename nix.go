@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Nix has two ways to manage the packages of a user: the legacy nix-env, and
+// `nix profile` which works with flakes. A profile can only be used by one of
+// them, so only one is detected (see detectPM).
+
+// parseDrvName splits a derivation name like "python3.11-requests-2.31.0"
+// the way Nix's builtins.parseDrvName does: the version starts at the first
+// dash that is not followed by a letter.
+func parseDrvName(drvName string) (name, version string) {
+	for i := 0; i < len(drvName)-1; i++ {
+		if drvName[i] != '-' {
+			continue
+		}
+		c := drvName[i+1]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return drvName[:i], drvName[i+1:]
+		}
+	}
+	return drvName, ""
+}
+
+// storePathName returns the derivation name of a store path, e.g. "hello-2.12.1"
+// for "/nix/store/<hash>-hello-2.12.1".
+func storePathName(storePath string) string {
+	base := path.Base(storePath)
+	if _, name, ok := strings.Cut(base, "-"); ok {
+		return name
+	}
+	return base
+}
+
+// nixEnvQueryArgs lists the packages installed with nix-env.
+var nixEnvQueryArgs = []string{"-q", "--json"}
+
+// parseNixEnvJSON parses `nix-env -q --json`, an object of
+// {"<attr>": {"name": "hello-2.12.1", "pname": "hello", "version": "2.12.1"}}.
+// Older Nix versions only print "name".
+func parseNixEnvJSON(out []byte) []Package {
+	var entries map[string]struct {
+		Name    string `json:"name"`
+		Pname   string `json:"pname"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil
+	}
+
+	var pkgs []Package
+	for attr, e := range entries {
+		name, version := e.Pname, e.Version
+		if name == "" {
+			name, version = parseDrvName(e.Name)
+		}
+		if name == "" {
+			name = attr
+		}
+		pkgs = append(pkgs, Package{
+			Name:        name,
+			Version:     version,
+			Manager:     "nix-env",
+			IsInstalled: true,
+		})
+	}
+	sortPackages(pkgs)
+	return pkgs
+}
+
+var nixProfileListArgs = []string{"profile", "list", "--json"}
+
+type nixProfileElement struct {
+	Active     *bool    `json:"active"`
+	AttrPath   string   `json:"attrPath"`
+	StorePaths []string `json:"storePaths"`
+}
+
+// parseNixProfileList parses `nix profile list --json`. Since Nix 2.20
+// (manifest version 3) elements is an object keyed by name; before it was an
+// array, and the name comes from the attribute path.
+func parseNixProfileList(out []byte) []Package {
+	var manifest struct {
+		Elements json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal(out, &manifest); err != nil {
+		return nil
+	}
+
+	elements := make(map[string]nixProfileElement)
+	var list []nixProfileElement
+	if err := json.Unmarshal(manifest.Elements, &elements); err != nil {
+		if err := json.Unmarshal(manifest.Elements, &list); err != nil {
+			return nil
+		}
+		for _, e := range list {
+			name := e.AttrPath[strings.LastIndex(e.AttrPath, ".")+1:]
+			if name == "" && len(e.StorePaths) > 0 {
+				name, _ = parseDrvName(storePathName(e.StorePaths[0]))
+			}
+			elements[name] = e
+		}
+	}
+
+	var pkgs []Package
+	for name, e := range elements {
+		if e.Active != nil && !*e.Active {
+			continue
+		}
+		version := ""
+		if len(e.StorePaths) > 0 {
+			_, version = parseDrvName(storePathName(e.StorePaths[0]))
+		}
+		pkgs = append(pkgs, Package{
+			Name:        name,
+			Version:     version,
+			Manager:     "nix-profile",
+			IsInstalled: true,
+		})
+	}
+	sortPackages(pkgs)
+	return pkgs
+}
+
+// sortPackages sorts packages by name, for outputs that come from maps.
+func sortPackages(pkgs []Package) {
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+}
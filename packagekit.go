@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// PackageKit is the D-Bus service that abstracts apt, dnf, zypper and others
+// on desktop Linux. Going through it, installing and removing packages is
+// authorized by polkit instead of the sudo in the command templates.
+//
+// It is used when lazyinstaller runs with --packagekit. Setting
+// LAZYINSTALLER_PACKAGEKIT_BUS=session talks to a PackageKit service on the
+// session bus instead of the system bus, e.g. the fake one of the tests.
+
+const (
+	pkService     = "org.freedesktop.PackageKit"
+	pkPath        = dbus.ObjectPath("/org/freedesktop/PackageKit")
+	pkIface       = "org.freedesktop.PackageKit"
+	pkTransaction = "org.freedesktop.PackageKit.Transaction"
+)
+
+// usePackageKit routes system package jobs and searches through PackageKit.
+var usePackageKit bool
+
+// PackageKit filters (PK_FILTER_ENUM_* as bits) and transaction flags.
+const (
+	pkFilterInstalled    uint64 = 1 << 2
+	pkFilterNotInstalled uint64 = 1 << 3
+	pkFilterNewest       uint64 = 1 << 16
+	pkFilterArch         uint64 = 1 << 18
+
+	pkTransactionFlagOnlyTrusted uint64 = 1 << 1
+)
+
+// PackageKit info and exit codes (PK_INFO_ENUM_*, PK_EXIT_ENUM_*).
+const (
+	pkInfoInstalled = 1
+	pkExitSuccess   = 1
+)
+
+// pkBackendManagers maps the PackageKit backend to the manager label of its
+// packages, so jobs on scanned packages can go through PackageKit.
+var pkBackendManagers = map[string]string{
+	"apt":    "apt/dpkg",
+	"aptcc":  "apt/dpkg",
+	"dnf":    "rpm/dnf",
+	"zypp":   "zypper",
+	"alpm":   "pacman",
+	"pacman": "pacman",
+	"apk":    "apk",
+	"nix":    "nix-env",
+}
+
+type packageKitClient struct {
+	conn    *dbus.Conn
+	backend string // e.g. "dnf"
+}
+
+func newPackageKitClient() (*packageKitClient, error) {
+	var conn *dbus.Conn
+	var err error
+	if os.Getenv("LAZYINSTALLER_PACKAGEKIT_BUS") == "session" {
+		conn, err = dbus.ConnectSessionBus()
+	} else {
+		conn, err = dbus.ConnectSystemBus()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("packagekit: %w", err)
+	}
+
+	c := &packageKitClient{conn: conn}
+	v, err := conn.Object(pkService, pkPath).GetProperty(pkIface + ".BackendName")
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("packagekit: %w", err)
+	}
+	c.backend, _ = v.Value().(string)
+	return c, nil
+}
+
+func (c *packageKitClient) Close() error {
+	return c.conn.Close()
+}
+
+// manager is the label of the packages handled by the PackageKit backend.
+func (c *packageKitClient) manager() string {
+	if m, ok := pkBackendManagers[c.backend]; ok {
+		return m
+	}
+	return "packagekit"
+}
+
+// handles tells whether jobs on packages of the manager can go through PackageKit.
+func (c *packageKitClient) handles(manager string) bool {
+	return managerKey(c.manager()) == managerKey(manager)
+}
+
+// pkPackage is a package reported by a transaction. Its ID is
+// "name;version;arch;data" where data is "installed" or the repository.
+type pkPackage struct {
+	info    uint32
+	id      string
+	summary string
+}
+
+func (p pkPackage) pkg(manager string) Package {
+	parts := strings.Split(p.id, ";")
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	return Package{
+		Name:        parts[0],
+		Version:     parts[1],
+		Manager:     manager,
+		IsInstalled: p.info == pkInfoInstalled || strings.HasPrefix(parts[3], "installed"),
+	}
+}
+
+// transaction runs a method on a new transaction and collects the packages it
+// reports until it finishes. progress, if not nil, gets the percentage.
+func (c *packageKitClient) transaction(ctx context.Context, progress func(percent uint32), method string, args ...any) ([]pkPackage, error) {
+	var path dbus.ObjectPath
+	err := c.conn.Object(pkService, pkPath).CallWithContext(ctx, pkIface+".CreateTransaction", 0).Store(&path)
+	if err != nil {
+		return nil, fmt.Errorf("packagekit: %w", err)
+	}
+
+	match := []dbus.MatchOption{dbus.WithMatchObjectPath(path)}
+	if err := c.conn.AddMatchSignalContext(ctx, match...); err != nil {
+		return nil, fmt.Errorf("packagekit: %w", err)
+	}
+	defer c.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 64)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	tx := c.conn.Object(pkService, path)
+	// Let polkit ask for authorization instead of failing
+	if call := tx.CallWithContext(ctx, pkTransaction+".SetHints", 0, []string{"interactive=true"}); call.Err != nil {
+		return nil, fmt.Errorf("packagekit: SetHints: %w", call.Err)
+	}
+	if call := tx.CallWithContext(ctx, pkTransaction+"."+method, 0, args...); call.Err != nil {
+		return nil, fmt.Errorf("packagekit: %s: %w", method, call.Err)
+	}
+
+	var pkgs []pkPackage
+	var txErr error
+	for {
+		select {
+		case <-ctx.Done():
+			tx.Call(pkTransaction+".Cancel", 0)
+			return nil, ctx.Err()
+		case sig, ok := <-signals:
+			if !ok {
+				return nil, errors.New("packagekit: connection closed")
+			}
+			if sig.Path != path {
+				continue
+			}
+			switch sig.Name {
+			case pkTransaction + ".Package":
+				var p pkPackage
+				if dbus.Store(sig.Body, &p.info, &p.id, &p.summary) == nil {
+					pkgs = append(pkgs, p)
+				}
+			case pkTransaction + ".ErrorCode":
+				var code uint32
+				var details string
+				if dbus.Store(sig.Body, &code, &details) == nil {
+					txErr = fmt.Errorf("packagekit: %s", details)
+				}
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				var iface string
+				var changed map[string]dbus.Variant
+				var invalidated []string
+				if progress != nil && dbus.Store(sig.Body, &iface, &changed, &invalidated) == nil {
+					if v, ok := changed["Percentage"]; ok {
+						if percent, ok := v.Value().(uint32); ok && percent <= 100 {
+							progress(percent)
+						}
+					}
+				}
+			case pkTransaction + ".Finished":
+				var exit, runtime uint32
+				if err := dbus.Store(sig.Body, &exit, &runtime); err == nil && exit != pkExitSuccess && txErr == nil {
+					txErr = fmt.Errorf("packagekit: %s failed", method)
+				}
+				return pkgs, txErr
+			}
+		}
+	}
+}
+
+func (c *packageKitClient) search(ctx context.Context, query string) ([]Package, error) {
+	found, err := c.transaction(ctx, nil, "SearchNames", pkFilterNewest|pkFilterArch, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make([]Package, 0, len(found))
+	for _, p := range found {
+		pkgs = append(pkgs, p.pkg(c.manager()))
+	}
+	return pkgs, nil
+}
+
+// resolve finds the package ID of a package name.
+func (c *packageKitClient) resolve(ctx context.Context, name string, filter uint64) (string, error) {
+	found, err := c.transaction(ctx, nil, "Resolve", filter|pkFilterArch, []string{name})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range found {
+		if p.pkg("").Name == name {
+			return p.id, nil
+		}
+	}
+	return "", fmt.Errorf("packagekit: package %q not found", name)
+}
+
+// update finds the package ID of the update of an installed package, which
+// UpdatePackages needs rather than the ID of the installed version.
+func (c *packageKitClient) update(ctx context.Context, name string) (string, error) {
+	found, err := c.transaction(ctx, nil, "GetUpdates", pkFilterArch)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range found {
+		if p.pkg("").Name == name {
+			return p.id, nil
+		}
+	}
+	return "", fmt.Errorf("packagekit: no update for %q", name)
+}
+
+// pkMethods maps job actions to the transaction methods that run them.
+var pkMethods = map[string]string{
+	"install":   "InstallPackages",
+	"uninstall": "RemovePackages",
+	"upgrade":   "UpdatePackages",
+}
+
+// run installs, removes or updates a package by name.
+func (c *packageKitClient) run(ctx context.Context, action string, name string, progress func(uint32)) error {
+	method, ok := pkMethods[action]
+	if !ok {
+		return fmt.Errorf("packagekit: unsupported action %q", action)
+	}
+	var id string
+	var err error
+	switch action {
+	case "install":
+		id, err = c.resolve(ctx, name, pkFilterNotInstalled|pkFilterNewest)
+	case "upgrade":
+		id, err = c.update(ctx, name)
+	default:
+		id, err = c.resolve(ctx, name, pkFilterInstalled)
+	}
+	if err != nil {
+		return err
+	}
+
+	args := []any{pkTransactionFlagOnlyTrusted, []string{id}}
+	if action == "uninstall" {
+		// Don't remove the packages that depend on it, nor autoremove
+		args = append(args, false, false)
+	}
+	_, err = c.transaction(ctx, progress, method, args...)
+	return err
+}
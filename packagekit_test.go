@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// startSessionBus starts a private D-Bus daemon for the test, and points
+// LAZYINSTALLER_PACKAGEKIT_BUS at it.
+func startSessionBus(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("no dbus-daemon")
+	}
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skip("can't start dbus-daemon:", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Skip("dbus-daemon printed no address:", err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+	t.Setenv("LAZYINSTALLER_PACKAGEKIT_BUS", "session")
+}
+
+// fakePackageKit serves the parts of the PackageKit API that lazyinstaller
+// uses on the session bus, over a few package IDs, and records the
+// transactions that change packages.
+type fakePackageKit struct {
+	conn      *dbus.Conn
+	installed []string // Package IDs
+	available []string
+	updates   []string
+	failHints bool
+
+	mu    sync.Mutex
+	txs   int
+	calls []string // e.g. "UpdatePackages bash;5.2.27-1.fc40;x86_64;updates"
+}
+
+func serveFakePackageKit(t *testing.T, pk *fakePackageKit) {
+	t.Helper()
+	startSessionBus(t)
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	pk.conn = conn
+
+	if err := conn.Export(pk, pkPath, pkIface); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prop.Export(conn, pkPath, prop.Map{
+		pkIface: {"BackendName": {Value: "dnf", Emit: prop.EmitFalse}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(pkService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("can't own %s: %v", pkService, err)
+	}
+}
+
+func (pk *fakePackageKit) CreateTransaction() (dbus.ObjectPath, *dbus.Error) {
+	pk.mu.Lock()
+	pk.txs++
+	path := dbus.ObjectPath(fmt.Sprintf("/%d_fake", pk.txs))
+	pk.mu.Unlock()
+	if err := pk.conn.Export(&fakeTransaction{pk: pk, path: path}, path, pkTransaction); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return path, nil
+}
+
+type fakeTransaction struct {
+	pk   *fakePackageKit
+	path dbus.ObjectPath
+}
+
+func (tx *fakeTransaction) SetHints(hints []string) *dbus.Error {
+	if tx.pk.failHints {
+		return dbus.MakeFailedError(errors.New("hints refused"))
+	}
+	return nil
+}
+
+func (tx *fakeTransaction) emit(signal string, args ...any) {
+	tx.pk.conn.Emit(tx.path, pkTransaction+"."+signal, args...)
+}
+
+// finish reports the packages, then ends the transaction.
+func (tx *fakeTransaction) finish(info uint32, ids []string) *dbus.Error {
+	for _, id := range ids {
+		tx.emit("Package", info, id, "")
+	}
+	tx.emit("Finished", uint32(pkExitSuccess), uint32(0))
+	return nil
+}
+
+func idsNamed(ids []string, names []string) []string {
+	var found []string
+	for _, id := range ids {
+		if slices.Contains(names, strings.Split(id, ";")[0]) {
+			found = append(found, id)
+		}
+	}
+	return found
+}
+
+func (tx *fakeTransaction) Resolve(filter uint64, names []string) *dbus.Error {
+	if filter&pkFilterInstalled != 0 {
+		return tx.finish(pkInfoInstalled, idsNamed(tx.pk.installed, names))
+	}
+	return tx.finish(2, idsNamed(tx.pk.available, names)) // PK_INFO_ENUM_AVAILABLE
+}
+
+func (tx *fakeTransaction) GetUpdates(filter uint64) *dbus.Error {
+	return tx.finish(5, tx.pk.updates) // PK_INFO_ENUM_NORMAL
+}
+
+func (tx *fakeTransaction) change(method string, ids []string) *dbus.Error {
+	tx.pk.mu.Lock()
+	tx.pk.calls = append(tx.pk.calls, method+" "+strings.Join(ids, ","))
+	tx.pk.mu.Unlock()
+	tx.pk.conn.Emit(tx.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+		pkTransaction, map[string]dbus.Variant{"Percentage": dbus.MakeVariant(uint32(50))}, []string{})
+	return tx.finish(pkInfoInstalled, nil)
+}
+
+func (tx *fakeTransaction) InstallPackages(flags uint64, ids []string) *dbus.Error {
+	return tx.change("InstallPackages", ids)
+}
+
+func (tx *fakeTransaction) RemovePackages(flags uint64, ids []string, allowDeps, autoremove bool) *dbus.Error {
+	return tx.change("RemovePackages", ids)
+}
+
+func (tx *fakeTransaction) UpdatePackages(flags uint64, ids []string) *dbus.Error {
+	return tx.change("UpdatePackages", ids)
+}
+
+func (tx *fakeTransaction) Cancel() *dbus.Error {
+	return nil
+}
+
+func newFakePackageKit() *fakePackageKit {
+	return &fakePackageKit{
+		installed: []string{"bash;5.2.26-3.fc40;x86_64;installed:fedora"},
+		available: []string{"bash;5.2.26-3.fc40;x86_64;fedora", "fd-find;9.0.0-1.fc40;x86_64;fedora"},
+		updates:   []string{"bash;5.2.27-1.fc40;x86_64;updates"},
+	}
+}
+
+func TestPackageKitRun(t *testing.T) {
+	fake := newFakePackageKit()
+	serveFakePackageKit(t, fake)
+	pk, err := newPackageKitClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pk.Close()
+	if !pk.handles("rpm/dnf") {
+		t.Errorf("backend %q doesn't handle rpm/dnf", pk.backend)
+	}
+
+	tests := []struct {
+		action, name string
+		call         string // "" if it fails
+	}{
+		{"install", "fd-find", "InstallPackages fd-find;9.0.0-1.fc40;x86_64;fedora"},
+		{"uninstall", "bash", "RemovePackages bash;5.2.26-3.fc40;x86_64;installed:fedora"},
+		// The ID of the update, not of the installed version
+		{"upgrade", "bash", "UpdatePackages bash;5.2.27-1.fc40;x86_64;updates"},
+		{"upgrade", "fd-find", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action+"/"+tt.name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.calls = nil
+			fake.mu.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var progress []uint32
+			err := pk.run(ctx, tt.action, tt.name, func(percent uint32) {
+				progress = append(progress, percent)
+			})
+
+			fake.mu.Lock()
+			calls := fake.calls
+			fake.mu.Unlock()
+			if tt.call == "" {
+				if err == nil || len(calls) > 0 {
+					t.Errorf("err = %v, calls = %q, want an error and no call", err, calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(calls, []string{tt.call}) {
+				t.Errorf("calls = %q, want %q", calls, tt.call)
+			}
+			if !slices.Equal(progress, []uint32{50}) {
+				t.Errorf("progress = %v, want [50]", progress)
+			}
+		})
+	}
+}
+
+// A transaction that can't be made interactive isn't run, as polkit
+// couldn't ask for authorization.
+func TestPackageKitSetHintsError(t *testing.T) {
+	fake := newFakePackageKit()
+	fake.failHints = true
+	serveFakePackageKit(t, fake)
+	pk, err := newPackageKitClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pk.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = pk.run(ctx, "uninstall", "bash", nil)
+	if err == nil || !strings.Contains(err.Error(), "SetHints") {
+		t.Errorf("err = %v, want the SetHints error", err)
+	}
+	if len(fake.calls) > 0 {
+		t.Errorf("calls = %q, want none", fake.calls)
+	}
+}
+
+// In dry-run mode, jobs through PackageKit report the method they'd call
+// rather than the command template.
+func TestPackageKitDryRun(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	pk := &packageKitClient{backend: "dnf"}
+	pkg := Package{Name: "bash", Manager: "rpm/dnf", IsInstalled: true}
+
+	msg := packageJob(fixtureRunner{dir: "testdata/fixtures/fedora"}, pk, "upgrade", pkg)()
+	done, ok := msg.(jobDoneMsg)
+	if !ok {
+		t.Fatalf("got %T, want jobDoneMsg", msg)
+	}
+	if got, want := done.status(), "[dry-run] PackageKit UpdatePackages bash"; got != want {
+		t.Errorf("status = %q, want %q", got, want)
+	}
+}
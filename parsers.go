@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The parsers turn the output of the package managers into packages. They
+// are pure functions over the raw output, so they can be checked against the
+// captured outputs in testdata/ (see fixtures.go).
+//
+// They all cope with CR/LF line endings, empty output and translated headers
+// (headers are skipped by position or shape, never by their text).
+
+// outputLines splits command output into lines, without line endings and
+// without empty lines.
+func outputLines(out []byte) []string {
+	var lines []string
+	for line := range bytes.Lines(out) {
+		line = bytes.TrimRight(line, "\r\n")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// tabFields splits a line of tab separated columns, as printed by
+// --format/--columns options, so names may contain spaces or commas.
+func tabFields(line string) []string {
+	fields := strings.Split(line, "\t")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// dpkgQueryArgs prints "status<TAB>name<TAB>version<TAB>size" for every
+// package dpkg knows about, including removed ones that still have config
+// files. The installed size is in KiB.
+var dpkgQueryArgs = []string{"-W", "-f=${db:Status-Abbrev}\t${binary:Package}\t${Version}\t${Installed-Size}\n"}
+
+func parseDpkgQuery(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if len(fields) < 3 || fields[1] == "" {
+			continue
+		}
+		// "ii" is installed, "hi" installed and on hold; "rc" is removed
+		// with config files left, which we don't list
+		if len(fields[0]) < 2 || fields[0][1] != 'i' {
+			continue
+		}
+		p := Package{
+			Name:        fields[1],
+			Version:     fields[2],
+			Manager:     "apt/dpkg",
+			IsInstalled: true,
+			Held:        fields[0][0] == 'h', // `apt-mark hold`
+		}
+		if len(fields) > 3 {
+			// Empty for the few packages that don't declare it
+			if kib, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+				p.Size = kib * 1024
+			}
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+// flatpakListArgs limits the list to applications (hiding runtimes), of both
+// the system and the user installations.
+// Without a terminal, flatpak separates the columns with tabs and prints no header.
+var flatpakListArgs = []string{"list", "--app", "--columns=" + flatpakColumns}
+
+// flatpakRuntimeListArgs lists the runtimes instead.
+var flatpakRuntimeListArgs = []string{"list", "--runtime", "--columns=" + flatpakColumns}
+
+const flatpakColumns = "application,version,branch,origin,installation,size"
+
+// parseFlatpakList parses `flatpak list` with flatpakColumns. Packages of the
+// user installation are managed by "flatpak-user", the others by "flatpak".
+func parseFlatpakList(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if fields[0] == "" {
+			continue
+		}
+		for len(fields) < 6 {
+			fields = append(fields, "")
+		}
+		// Runtimes and some apps have no version, only a branch (e.g. "48")
+		version := fields[1]
+		if version == "" {
+			version = fields[2]
+		}
+		manager := "flatpak"
+		if fields[4] == "user" {
+			manager = "flatpak-user"
+		}
+		size, _ := parseHumanSize(fields[5]) // e.g. "1.2 MB"
+		pkgs = append(pkgs, Package{
+			Name:        fields[0],
+			Version:     version,
+			Manager:     manager,
+			IsInstalled: true,
+			Origin:      fields[3],
+			Size:        size,
+		})
+	}
+	return pkgs
+}
+
+// pacmanInfoArgs describes every installed package, in the C locale as the
+// field names are translated.
+var pacmanInfoArgs = []string{"LC_ALL=C", "pacman", "-Qi"}
+
+// parsePacmanInfo parses the "Field : value" stanzas of `pacman -Qi`, one
+// per package. Fields with several values continue on indented lines.
+func parsePacmanInfo(out []byte) []Package {
+	var pkgs []Package
+	var p Package
+	for line := range bytes.Lines(out) {
+		text := strings.TrimRight(string(line), "\r\n")
+		if text == "" {
+			if p.Name != "" {
+				pkgs = append(pkgs, p)
+			}
+			p = Package{} // End of stanza
+			continue
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || text[0] == ' ' {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Name":
+			p = Package{Name: value, Manager: "pacman", IsInstalled: true}
+		case "Version":
+			p.Version = value
+		case "Installed Size":
+			p.Size, _ = parseHumanSize(value) // e.g. "1.50 MiB"
+		case "Install Reason":
+			p.Dependency = strings.HasPrefix(value, "Installed as a dependency")
+		}
+	}
+	if p.Name != "" {
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+// brewInfoArgs describes every installed formula and cask as JSON.
+var brewInfoArgs = []string{"info", "--json=v2", "--installed"}
+
+// parseBrewInfoJSON parses `brew info --json=v2 --installed`. The version of
+// a formula is the linked one, or the newest installed if none is linked.
+func parseBrewInfoJSON(out []byte) []Package {
+	var info struct {
+		Formulae []struct {
+			Name      string `json:"name"`
+			LinkedKeg string `json:"linked_keg"`
+			Installed []struct {
+				Version      string `json:"version"`
+				AsDependency bool   `json:"installed_as_dependency"`
+				OnRequest    bool   `json:"installed_on_request"`
+			} `json:"installed"`
+		} `json:"formulae"`
+		Casks []struct {
+			Token     string `json:"token"`
+			Installed string `json:"installed"`
+		} `json:"casks"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil
+	}
+
+	var pkgs []Package
+	for _, f := range info.Formulae {
+		version := f.LinkedKeg
+		dependency := false
+		if len(f.Installed) > 0 {
+			last := f.Installed[len(f.Installed)-1]
+			if version == "" {
+				version = last.Version
+			}
+			dependency = last.AsDependency && !last.OnRequest
+		}
+		pkgs = append(pkgs, Package{Name: f.Name, Version: version, Manager: "brew", IsInstalled: true, Dependency: dependency})
+	}
+	for _, c := range info.Casks {
+		pkgs = append(pkgs, Package{Name: c.Token, Version: c.Installed, Manager: "brew", IsInstalled: true})
+	}
+	return pkgs
+}
+
+// parsePortInstalled parses `port installed active`. After a header line, each
+// port is indented: "  curl @8.4.0_0+ssl (active)".
+func parsePortInstalled(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range outputLines(out) {
+		if line[0] != ' ' && line[0] != '\t' {
+			continue // Header, e.g. "The following ports are currently installed:"
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Version is fields[1], usually starting with '@'
+		pkgs = append(pkgs, Package{
+			Name:        fields[0],
+			Version:     strings.TrimPrefix(fields[1], "@"),
+			Manager:     "macports",
+			IsInstalled: true,
+		})
+	}
+	return pkgs
+}
+
+// rpmQueryArgs prints "name<TAB>version-release<TAB>size" for every package,
+// the size in bytes.
+var rpmQueryArgs = []string{"-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{SIZE}\n"}
+
+func parseRpmQuery(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		p := Package{
+			Name:        fields[0],
+			Version:     fields[1],
+			Manager:     "rpm/dnf",
+			IsInstalled: true,
+		}
+		if len(fields) > 2 {
+			p.Size, _ = strconv.ParseInt(fields[2], 10, 64)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+// dnfRepoqueryArgs lists the installed packages as JSON (dnf5).
+var dnfRepoqueryArgs = []string{"repoquery", "--installed", "--json"}
+
+// parseDnfRepoqueryJSON parses `dnf repoquery --json`, an array of packages
+// with their name, epoch, version and release.
+func parseDnfRepoqueryJSON(out []byte) []Package {
+	var entries []struct {
+		Name    string `json:"name"`
+		Epoch   any    `json:"epoch"` // A string or a number depending on the dnf5 version
+		Version string `json:"version"`
+		Release string `json:"release"`
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil
+	}
+
+	var pkgs []Package
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.Name == "" || seen[e.Name] {
+			continue // Multilib packages are listed once per arch
+		}
+		seen[e.Name] = true
+		version := e.Version
+		if e.Release != "" {
+			version += "-" + e.Release
+		}
+		switch epoch := e.Epoch.(type) {
+		case string:
+			if epoch != "" && epoch != "0" {
+				version = epoch + ":" + version
+			}
+		case float64:
+			if epoch != 0 {
+				version = fmt.Sprintf("%d:%s", int(epoch), version)
+			}
+		}
+		pkgs = append(pkgs, Package{Name: e.Name, Version: version, Manager: "rpm/dnf", IsInstalled: true})
+	}
+	return pkgs
+}
+
+// parseGuixInstalled parses `guix package -I`, which prints tab separated
+// "name version output store-path".
+func parseGuixInstalled(out []byte) []Package {
+	var pkgs []Package
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if len(fields) < 2 {
+			fields = strings.Fields(line)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name:        fields[0],
+			Version:     fields[1],
+			Manager:     "guix",
+			IsInstalled: true,
+		})
+	}
+	return pkgs
+}
+
+// parseAptCacheSearch parses `apt-cache search`, "name - description" per
+// line, into package names.
+func parseAptCacheSearch(out []byte) []string {
+	var names []string
+	for _, line := range outputLines(out) {
+		name, _, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// parseAptCacheShow parses the stanzas of `apt-cache show`, whose field names
+// are never translated, into a map of package name to version.
+func parseAptCacheShow(out []byte) map[string]string {
+	versions := make(map[string]string)
+	name := ""
+	for line := range bytes.Lines(out) {
+		text := strings.TrimRight(string(line), "\r\n")
+		if text == "" {
+			name = "" // End of stanza
+			continue
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || text[0] == ' ' {
+			continue
+		}
+		switch key {
+		case "Package":
+			name = strings.TrimSpace(value)
+		case "Version":
+			if _, seen := versions[name]; name != "" && !seen {
+				versions[name] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return versions
+}
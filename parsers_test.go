@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// The parsers are checked against the captured outputs in testdata/fixtures,
+// read through the fixture runner as the scanners would.
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		dir   string
+		argv  []string
+		parse func([]byte) []Package
+		want  []Package
+	}{
+		{
+			// CR/LF line endings, "rc" removed packages, "hi" holds and an empty size
+			dir:   "ubuntu",
+			argv:  append([]string{"dpkg-query"}, dpkgQueryArgs...),
+			parse: parseDpkgQuery,
+			want: []Package{
+				{Name: "adduser", Manager: "apt/dpkg", Version: "3.134", IsInstalled: true, Size: 627 * 1024},
+				{Name: "libc6:amd64", Manager: "apt/dpkg", Version: "2.36-9+deb12u4", IsInstalled: true, Held: true, Size: 13386 * 1024},
+				{Name: "linux-image-6.1.0-13-amd64", Manager: "apt/dpkg", Version: "6.1.55-1", IsInstalled: true, Held: true, Size: 398451 * 1024},
+				{Name: "fonts-noto-cjk", Manager: "apt/dpkg", Version: "1:20220127+repack1-1", IsInstalled: true, Size: 91736 * 1024},
+			},
+		},
+		{
+			// Both installations, sizes with a no-break space and an app without a version
+			dir:   "ubuntu",
+			argv:  append([]string{"flatpak"}, flatpakListArgs...),
+			parse: parseFlatpakList,
+			want: []Package{
+				{Name: "org.gnome.Calculator", Manager: "flatpak", Version: "45.0.2", IsInstalled: true, Origin: "flathub", Size: 12900000},
+				{Name: "com.example.Editor", Manager: "flatpak-user", Version: "2024.1 (beta)", IsInstalled: true, Origin: "flathub-beta", Size: 1100000000},
+				{Name: "org.example.NoVersion", Manager: "flatpak-user", Version: "stable", IsInstalled: true, Origin: "example-repo", Size: 987},
+				{Name: "org.example.Notes", Manager: "flatpak-user", Version: "3.1, nightly", IsInstalled: true, Origin: "example-repo", Size: 2500000},
+			},
+		},
+		{
+			// Continuation lines, dependencies and a stanza without a trailing blank line
+			dir:   "arch",
+			argv:  append([]string{"env"}, pacmanInfoArgs...),
+			parse: parsePacmanInfo,
+			want: []Package{
+				{Name: "base", Manager: "pacman", Version: "3-2", IsInstalled: true},
+				{Name: "linux", Manager: "pacman", Version: "6.7.9.arch1-1", IsInstalled: true, Size: 137489285},
+				{Name: "python-pip", Manager: "pacman", Version: "24.0-1", IsInstalled: true, Size: 15403581},
+				{Name: "xorg-server", Manager: "pacman", Version: "21.1.11-1", IsInstalled: true, Size: 3974103, Dependency: true},
+			},
+		},
+		{
+			dir:   "centos",
+			argv:  append([]string{"rpm"}, rpmQueryArgs...),
+			parse: parseRpmQuery,
+			want: []Package{
+				{Name: "bash", Manager: "rpm/dnf", Version: "5.2.26-3.fc40", IsInstalled: true, Size: 8460375},
+				{Name: "gcc-c++", Manager: "rpm/dnf", Version: "14.0.1-0.15.fc40", IsInstalled: true, Size: 43046810},
+				{Name: "gpg-pubkey", Manager: "rpm/dnf", Version: "8d1f36e3-65c6f1d1", IsInstalled: true},
+				{Name: "python3.12", Manager: "rpm/dnf", Version: "3.12.2-2.fc40", IsInstalled: true, Size: 33129},
+			},
+		},
+		{
+			// Epochs as strings and numbers, multilib packages listed twice
+			dir:   "fedora",
+			argv:  append([]string{"dnf"}, dnfRepoqueryArgs...),
+			parse: parseDnfRepoqueryJSON,
+			want: []Package{
+				{Name: "bash", Manager: "rpm/dnf", Version: "5.2.26-3.fc40", IsInstalled: true},
+				{Name: "gcc-c++", Manager: "rpm/dnf", Version: "14.0.1-0.15.fc40", IsInstalled: true},
+				{Name: "glibc", Manager: "rpm/dnf", Version: "2.39-2.fc40", IsInstalled: true},
+				{Name: "NetworkManager", Manager: "rpm/dnf", Version: "1:1.46.0-1.fc40", IsInstalled: true},
+			},
+		},
+		{
+			dir:   "brew",
+			argv:  append([]string{"brew"}, brewInfoArgs...),
+			parse: parseBrewInfoJSON,
+			want: []Package{
+				{Name: "fd", Manager: "brew", Version: "9.0.0", IsInstalled: true},
+				{Name: "openssl@3", Manager: "brew", Version: "3.2.1", IsInstalled: true, Dependency: true},
+				{Name: "python@3.12", Manager: "brew", Version: "3.12.2_1", IsInstalled: true},
+				{Name: "visual-studio-code", Manager: "brew", Version: "1.87.2", IsInstalled: true},
+			},
+		},
+		{
+			dir:   "brew",
+			argv:  []string{"port", "installed", "active"},
+			parse: parsePortInstalled,
+			want: []Package{
+				{Name: "curl", Manager: "macports", Version: "8.4.0_0+ssl", IsInstalled: true},
+				{Name: "py312-pip", Manager: "macports", Version: "24.0_0", IsInstalled: true},
+			},
+		},
+		{
+			// Names ending in digits and a package without a version
+			dir:   "arch",
+			argv:  append([]string{"nix-env"}, nixEnvQueryArgs...),
+			parse: parseNixEnvJSON,
+			want: []Package{
+				{Name: "hello", Manager: "nix-env", Version: "2.12.1", IsInstalled: true},
+				{Name: "nix-index", Manager: "nix-env", IsInstalled: true},
+				{Name: "python3.11-requests", Manager: "nix-env", Version: "2.31.0", IsInstalled: true},
+			},
+		},
+		{
+			dir:   "nix-profile",
+			argv:  append([]string{"nix"}, nixProfileListArgs...),
+			parse: parseNixProfileList,
+			want: []Package{
+				{Name: "hello", Manager: "nix-profile", Version: "2.12.1", IsInstalled: true},
+				{Name: "python3.11-requests", Manager: "nix-profile", Version: "2.31.0", IsInstalled: true},
+			},
+		},
+		{
+			// CR/LF line endings and an output other than "out"
+			dir:   "guix",
+			argv:  []string{"guix", "package", "-I"},
+			parse: parseGuixInstalled,
+			want: []Package{
+				{Name: "hello", Manager: "guix", Version: "2.12.1", IsInstalled: true},
+				{Name: "gcc-toolchain", Manager: "guix", Version: "13.2.0", IsInstalled: true},
+				{Name: "glibc", Manager: "guix", Version: "2.35", IsInstalled: true},
+				{Name: "python-requests", Manager: "guix", Version: "2.31.0", IsInstalled: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir+"/"+tt.argv[0], func(t *testing.T) {
+			r := fixtureRunner{dir: "testdata/fixtures/" + tt.dir}
+			out, err := r.Output(context.Background(), tt.argv[0], tt.argv[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.parse(out); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsersEmptyOutput(t *testing.T) {
+	parsers := map[string]func([]byte) []Package{
+		"dpkg-query": parseDpkgQuery,
+		"flatpak":    parseFlatpakList,
+		"pacman":     parsePacmanInfo,
+		"rpm":        parseRpmQuery,
+		"dnf":        parseDnfRepoqueryJSON,
+		"brew":       parseBrewInfoJSON,
+		"port":       parsePortInstalled,
+		"guix":       parseGuixInstalled,
+	}
+	for name, parse := range parsers {
+		for _, out := range []string{"", "\n", "\r\n\r\n"} {
+			if pkgs := parse([]byte(out)); len(pkgs) > 0 {
+				t.Errorf("%s: parse(%q) = %+v, want none", name, out, pkgs)
+			}
+		}
+	}
+}
+
+func fixtureOutput(t *testing.T, dir string, argv ...string) []byte {
+	t.Helper()
+	out, err := fixtureRunner{dir: "testdata/fixtures/" + dir}.Output(context.Background(), argv[0], argv[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestParseAptCache(t *testing.T) {
+	out := fixtureOutput(t, "ubuntu", "apt-cache", "search", "--names-only", "fd")
+	if got, want := parseAptCacheSearch(out), []string{"fd-find", "fdisk", "fdupes"}; !slices.Equal(got, want) {
+		t.Errorf("parseAptCacheSearch = %q, want %q", got, want)
+	}
+
+	// A translated description and a field continued on the next line
+	out = fixtureOutput(t, "ubuntu", "apt-cache", "show", "--no-all-versions", "fd-find", "fdisk", "fdupes")
+	want := map[string]string{"fd-find": "8.6.0-3", "fdisk": "2.38.1-5+deb12u1", "fdupes": "1:2.2.1-1"}
+	if got := parseAptCacheShow(out); !maps.Equal(got, want) {
+		t.Errorf("parseAptCacheShow = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeSnapdSnaps(t *testing.T) {
+	tests := []struct {
+		file      string
+		installed bool
+		want      []Package
+	}{
+		{
+			// Bases and snapd are dependencies, a held snap and a version with a space
+			file:      "snapd_GET__v2_snaps.json",
+			installed: true,
+			want: []Package{
+				{Name: "core22", Manager: "snap", Version: "20240111", IsInstalled: true, Dependency: true},
+				{Name: "firefox", Manager: "snap", Version: "123.0-2", IsInstalled: true, Held: true},
+				{Name: "code", Manager: "snap", Version: "1.87.2 (beta)", IsInstalled: true},
+				{Name: "snapd", Manager: "snap", Version: "2.61.2", IsInstalled: true, Dependency: true},
+			},
+		},
+		{
+			file: "snapd_GET__v2_find_q_fd.json",
+			want: []Package{
+				{Name: "fd", Manager: "snap", Version: "8.7.0"},
+				{Name: "firefox", Manager: "snap", Version: "124.0-1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata/fixtures/ubuntu", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var snaps []snapdSnap
+			if _, err := decodeSnapdResponse(body, &snaps); err != nil {
+				t.Fatal(err)
+			}
+			var got []Package
+			for _, s := range snaps {
+				got = append(got, s.pkg(tt.installed))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Headers and section titles of the fedora fixtures are in German.
+func TestParseDnfTranslated(t *testing.T) {
+	var repos []repository
+	for _, enabled := range []bool{true, false} {
+		flag := "--enabled"
+		if !enabled {
+			flag = "--disabled"
+		}
+		repos = append(repos, parseDnfRepolist(fixtureOutput(t, "fedora", "dnf", "repolist", flag), enabled)...)
+	}
+	wantRepos := []repository{
+		{Manager: "dnf", Name: "fedora", URL: "Fedora 41 - x86_64", Enabled: true},
+		{Manager: "dnf", Name: "updates", URL: "Fedora 41 - x86_64 - Updates", Enabled: true},
+		{Manager: "dnf", Name: "updates-testing", URL: "Fedora 41 - x86_64 - Test Updates"},
+	}
+	if !slices.Equal(repos, wantRepos) {
+		t.Errorf("parseDnfRepolist = %+v, want %+v", repos, wantRepos)
+	}
+
+	versions := parseDnfListDuplicates(fixtureOutput(t, "fedora", "dnf", "list", "--showduplicates", "bash"), "bash")
+	wantVersions := []packageVersion{
+		{Version: "5.2.26-1.fc40", Detail: "fedora"},
+		{Version: "5.2.26-3.fc40", Detail: "updates"},
+	}
+	if !slices.Equal(versions, wantVersions) {
+		t.Errorf("parseDnfListDuplicates = %+v, want %+v", versions, wantVersions)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"runtime"
+	"slices"
 )
 
 type packageManager struct {
@@ -12,7 +14,7 @@ type packageManager struct {
 
 // var pm packageManager
 
-func detectPM() []packageManager {
+func detectPM(r Runner) []packageManager {
 	var detectedPMs []packageManager
 	operatingSystem := runtime.GOOS
 	switch operatingSystem {
@@ -20,20 +22,20 @@ func detectPM() []packageManager {
 		fmt.Println("Windows support is minimal.")
 		// Potential windows logic could be added here similar to linux/mac
 	case "darwin":
-		if ok, path := isInstalled("brew"); ok {
+		if ok, path := isInstalled(r, "brew"); ok {
 			detectedPMs = append(detectedPMs, packageManager{Name: "brew", Path: path})
 		}
-		if ok, path := isInstalled("port"); ok {
+		if ok, path := isInstalled(r, "port"); ok {
 			detectedPMs = append(detectedPMs, packageManager{Name: "port", Path: path})
 		}
 	case "linux":
-		checks := []string{"dpkg", "dpkg-query", "apt", "dnf", "pacman", "snap", "flatpak", "zypper", "yum", "apk", "xbps-install", "emerge", "nix-env", "brew", "port", "winget", "choco", "scoop"}
+		checks := []string{"dpkg", "dpkg-query", "apt", "dnf", "pacman", "snap", "flatpak", "zypper", "yum", "apk", "xbps-install", "emerge", "nix-env", "guix", "brew", "port", "winget", "choco", "scoop"}
 		for _, p := range checks {
 			wrapperName := p
 			if p == "xbps-install" {
 				wrapperName = "xbps"
 			}
-			if ok, path := isInstalled(p); ok {
+			if ok, path := isInstalled(r, p); ok {
 				detectedPMs = append(detectedPMs, packageManager{Name: wrapperName, Path: path})
 			}
 		}
@@ -42,6 +44,23 @@ func detectPM() []packageManager {
 		fmt.Printf("Unknown operating system: %s\n", operatingSystem)
 	}
 
+	// A Nix profile is managed either by nix-env or by `nix profile`, and
+	// `nix profile list` fails on profiles that belong to nix-env
+	if operatingSystem == "linux" || operatingSystem == "darwin" {
+		if ok, path := isInstalled(r, "nix"); ok {
+			if _, err := r.Output(context.Background(), "nix", nixProfileListArgs...); err == nil {
+				detectedPMs = slices.DeleteFunc(detectedPMs, func(p packageManager) bool { return p.Name == "nix-env" })
+				detectedPMs = append(detectedPMs, packageManager{Name: "nix-profile", Path: path})
+			}
+		}
+	}
+
+	// Flatpak has a system-wide installation and one per user, which is
+	// managed without sudo
+	if i := slices.IndexFunc(detectedPMs, func(p packageManager) bool { return p.Name == "flatpak" }); i >= 0 {
+		detectedPMs = append(detectedPMs, packageManager{Name: "flatpak-user", Path: detectedPMs[i].Path})
+	}
+
 	// Deduplicate detectedPMs based on Name
 	uniquePMs := make([]packageManager, 0, len(detectedPMs))
 	seen := make(map[string]bool)
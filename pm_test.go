@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestDetectPM(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fixtures are of Linux machines")
+	}
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{"ubuntu", []string{"dpkg", "dpkg-query", "apt", "snap", "flatpak", "flatpak-user"}},
+		{"fedora", []string{"dnf", "flatpak", "flatpak-user"}},
+		{"centos", []string{"dnf"}},
+		{"arch", []string{"pacman", "nix-env", "guix"}},
+		{"brew", []string{"brew", "port"}},
+		{"guix", []string{"guix"}},
+		// `nix profile list` works, so nix-env is replaced
+		{"nix-profile", []string{"nix-profile"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			var got []string
+			for _, pm := range detectPM(fixtureRunner{dir: "testdata/fixtures/" + tt.dir}) {
+				got = append(got, pm.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("detectPM = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
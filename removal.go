@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// removalImpact is what goes with a package when it's removed, as simulated
+// by its manager.
+type removalImpact struct {
+	pkg        Package
+	Dependents []string // Installed packages that depend on it
+	Orphans    []string // Dependencies nothing needs without it
+	orphansErr error    // Why the orphans aren't known, if they aren't
+
+	// How the Uninstall template (or PackageKit) treats them
+	dependentsRemoved bool // Removed along, or else the removal fails
+	orphansRemoved    bool // Removed along, or else left installed
+}
+
+// removalSimulator lists what a removal would take, without removing
+// anything.
+type removalSimulator struct {
+	simulate          func(ctx context.Context, r Runner, name string) (dependents, orphans []string, err error)
+	dependentsRemoved bool
+	orphansRemoved    bool
+}
+
+var removalSimulators = map[string]removalSimulator{
+	// `apt remove` removes the dependents, `apt autoremove` the orphans later
+	"apt": {simulate: simulateAptRemoval, dependentsRemoved: true},
+	// `pacman -Rs` removes the orphans, and refuses to break dependents
+	"pacman": {simulate: simulatePacmanRemoval, orphansRemoved: true},
+	// `dnf remove` removes both, unless clean_requirements_on_remove is off
+	"dnf": {simulate: simulateDnfRemoval, dependentsRemoved: true, orphansRemoved: true},
+}
+
+// simulateRemoval previews the removal of a package. With PackageKit, which
+// is asked not to remove dependents nor orphans, dependents make it fail.
+func simulateRemoval(ctx context.Context, r Runner, pkg Package, viaPackageKit bool) (removalImpact, error) {
+	s, ok := removalSimulators[managerKey(pkg.Manager)]
+	if !ok {
+		return removalImpact{}, fmt.Errorf("previewing removals is not supported by %s", pkg.Manager)
+	}
+	dependents, orphans, err := s.simulate(ctx, r, pkg.Name)
+	var orphansErr error
+	if errors.Is(err, errOrphansUnknown) {
+		orphansErr, err = err, nil
+	}
+	if err != nil {
+		return removalImpact{}, err
+	}
+	impact := removalImpact{
+		pkg:               pkg,
+		Dependents:        dependents,
+		Orphans:           orphans,
+		orphansErr:        orphansErr,
+		dependentsRemoved: s.dependentsRemoved && !viaPackageKit,
+		orphansRemoved:    s.orphansRemoved && !viaPackageKit,
+	}
+	return impact, nil
+}
+
+// simulateAptRemoval compares what `apt-get -s remove` removes ("Remv name
+// [version]" lines, which are not translated) with and without
+// --autoremove.
+func simulateAptRemoval(ctx context.Context, r Runner, name string) ([]string, []string, error) {
+	out, err := r.Output(ctx, "apt-get", "-s", "remove", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	removed := parseAptSimulation(out)
+	out, err = r.Output(ctx, "apt-get", "-s", "--autoremove", "remove", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	withOrphans := parseAptSimulation(out)
+	return without(removed, name), without(withOrphans, append(removed, name)...), nil
+}
+
+// parseAptSimulation lists the packages removed by an `apt-get -s` run.
+func parseAptSimulation(out []byte) []string {
+	var names []string
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "Remv" {
+			names = append(names, fields[1])
+		}
+	}
+	return names
+}
+
+// simulatePacmanRemoval prints the packages `pacman -Rc` (cascade, i.e. the
+// dependents) would remove, and what -s (recursive, i.e. the orphans) adds.
+// -s alone fails if the package has dependents.
+func simulatePacmanRemoval(ctx context.Context, r Runner, name string) ([]string, []string, error) {
+	var lists [2][]string
+	for i, flag := range []string{"-Rcp", "-Rcsp"} {
+		out, err := r.Output(ctx, "pacman", flag, "--print-format", "%n", name)
+		if err != nil {
+			return nil, nil, err
+		}
+		lists[i] = without(parseNameList(out), name)
+	}
+	return lists[0], without(lists[1], lists[0]...), nil
+}
+
+// errOrphansUnknown is returned with the dependents of a package when the
+// dependencies its removal leaves unneeded can't be told.
+var errOrphansUnknown = errors.New("dnf only lists the dependencies left unneeded for root")
+
+// simulateDnfRemoval parses the transaction `dnf remove --assumeno` shows
+// before aborting it. Its sections are told apart by their headers, which
+// are translated, so it runs in the C locale.
+//
+// dnf4 refuses to resolve a removal for other users than root, so the
+// dependents are then listed with `dnf repoquery --whatrequires`, and the
+// orphans are left unknown.
+func simulateDnfRemoval(ctx context.Context, r Runner, name string) ([]string, []string, error) {
+	// dnf exits with an error once it has printed the transaction
+	out, err := r.Output(ctx, "env", "LC_ALL=C", "dnf", "remove", "--assumeno", name)
+	if bytes.Contains(out, []byte("Removing")) {
+		dependents, orphans := parseDnfRemoveTransaction(out)
+		return without(dependents, name), without(orphans, name), nil
+	}
+	out, qerr := r.Output(ctx, "dnf", "repoquery", "--installed", "--whatrequires", name, "--recursive", "--queryformat", `%{name}\n`)
+	if qerr != nil {
+		if err == nil {
+			err = qerr
+		}
+		return nil, nil, err
+	}
+	var dependents []string
+	for _, n := range parseDepNames(out) {
+		dependents = append(dependents, n.Name)
+	}
+	return without(dependents, name), nil, errOrphansUnknown
+}
+
+// parseDnfRemoveTransaction parses the "Removing dependent packages:" and
+// "Removing unused dependencies:" sections of a dnf4 or dnf5 transaction
+// table, whose rows are " name arch version repo size". dnf4 wraps long
+// names, indenting the rest of the row further, and dnf5 lists what a
+// package replaces under it the same way.
+func parseDnfRemoveTransaction(out []byte) (dependents, orphans []string) {
+	var section *[]string
+	for _, line := range outputLines(out) {
+		switch {
+		case line[0] != ' ':
+			header := strings.ToLower(line)
+			switch {
+			case strings.Contains(header, "dependent"):
+				section = &dependents
+			case strings.Contains(header, "unused"):
+				section = &orphans
+			default:
+				section = nil
+			}
+		case section != nil && line[1] != ' ':
+			*section = append(*section, strings.Fields(line)[0])
+		}
+	}
+	return dependents, orphans
+}
+
+// without returns the names but the excluded ones.
+func without(names []string, excluded ...string) []string {
+	return slices.DeleteFunc(slices.Clone(names), func(n string) bool { return slices.Contains(excluded, n) })
+}
+
+// dependentsHeading and orphansHeading tell what happens to the packages.
+func (i removalImpact) dependentsHeading() string {
+	if i.dependentsRemoved {
+		return "Also removed, as they depend on it"
+	}
+	return "Depend on it, so it can't be removed before them"
+}
+
+func (i removalImpact) orphansHeading() string {
+	if i.orphansRemoved {
+		return "No longer needed, removed too"
+	}
+	return "No longer needed, left installed"
+}
+
+// summary is a one-line summary of the impact, for the status bar.
+func (i removalImpact) summary() string {
+	var parts []string
+	if len(i.Dependents) > 0 {
+		parts = append(parts, plural(len(i.Dependents), "dependent")+" ("+strings.Join(i.Dependents, ", ")+")")
+	}
+	if len(i.Orphans) > 0 {
+		parts = append(parts, plural(len(i.Orphans), "orphan")+" ("+strings.Join(i.Orphans, ", ")+")")
+	}
+	summary := "Removing " + i.pkg.Name + " affects " + strings.Join(parts, " and ") + "."
+	switch {
+	case i.orphansErr != nil && len(parts) == 0:
+		summary = "No installed package depends on " + i.pkg.Name + "."
+	case len(parts) == 0:
+		summary = "Removing " + i.pkg.Name + " affects no other package."
+	}
+	if i.orphansErr != nil {
+		summary += " Unneeded dependencies aren't known: " + i.orphansErr.Error() + "."
+	}
+	return summary
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// lines lists the impact under a heading per kind.
+func (i removalImpact) lines() []string {
+	lines := []string{"Removing " + i.pkg.Name + " (" + i.pkg.Manager + ")"}
+	for _, group := range []struct {
+		heading string
+		names   []string
+	}{{i.dependentsHeading(), i.Dependents}, {i.orphansHeading(), i.Orphans}} {
+		if len(group.names) == 0 {
+			continue
+		}
+		lines = append(lines, "", fmt.Sprintf("%s (%d):", group.heading, len(group.names)))
+		for _, name := range group.names {
+			lines = append(lines, "  "+name)
+		}
+	}
+	switch {
+	case i.orphansErr != nil:
+		lines = append(lines, "", "Unneeded dependencies aren't known: "+i.orphansErr.Error()+".")
+	case len(i.Dependents) == 0 && len(i.Orphans) == 0:
+		lines = append(lines, "", "No other package depends on it or is left unneeded.")
+	}
+	return lines
+}
+
+// note is the impact as a plan note, e.g. for `apply --prune`.
+func (i removalImpact) note() string {
+	var parts []string
+	if len(i.Dependents) > 0 {
+		if i.dependentsRemoved {
+			parts = append(parts, "also removes "+strings.Join(i.Dependents, ", "))
+		} else {
+			parts = append(parts, "fails, as "+strings.Join(i.Dependents, ", ")+" depend on it")
+		}
+	}
+	if len(i.Orphans) > 0 {
+		if i.orphansRemoved {
+			parts = append(parts, "also removes the unneeded "+strings.Join(i.Orphans, ", "))
+		} else {
+			parts = append(parts, "leaves "+strings.Join(i.Orphans, ", ")+" unneeded")
+		}
+	}
+	if i.orphansErr != nil {
+		parts = append(parts, "unneeded dependencies aren't known")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// removalImpactMsg carries the preview of a removal asked from the TUI.
+type removalImpactMsg struct {
+	pkg    Package
+	impact removalImpact
+	err    error
+}
+
+func loadRemovalImpact(r Runner, pkg Package, viaPackageKit bool) tea.Cmd {
+	return func() tea.Msg {
+		impact, err := simulateRemoval(context.Background(), r, pkg, viaPackageKit)
+		return removalImpactMsg{pkg: pkg, impact: impact, err: err}
+	}
+}
+
+// previewRemovalSteps notes what the removals of a plan take along.
+func previewRemovalSteps(ctx context.Context, r Runner, steps []planStep) {
+	for i, s := range steps {
+		if s.Action != planRemove || s.Command == "" {
+			continue
+		}
+		impact, err := simulateRemoval(ctx, r, Package{Name: s.Name, Manager: s.Manager}, false)
+		if err != nil {
+			continue
+		}
+		if note := impact.note(); note != "" {
+			steps[i].Note = note
+		}
+	}
+}
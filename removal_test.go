@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseDnfRemoveTransaction(t *testing.T) {
+	tests := []struct {
+		name, out  string
+		dependents []string
+		orphans    []string
+	}{
+		{
+			// A long name wraps the rest of its row
+			name: "dnf4",
+			out: `Dependencies resolved.
+================================================================================
+ Package                     Arch      Version             Repository     Size
+================================================================================
+Removing:
+ bash-completion             noarch    1:2.11-15.fc40      @fedora       1.2 M
+Removing dependent packages:
+ flatpak-bash-completion-integration-with-a-long-name
+                             noarch    1.15.8-1.fc40       @updates       12 k
+ git-bash-completion         noarch    2.44.0-1.fc40       @updates       80 k
+Removing unused dependencies:
+ pkgconf-pkg-config          x86_64    2.1.1-1.fc40        @fedora         0
+
+Transaction Summary
+================================================================================
+Remove  4 Packages
+
+Freed space: 1.3 M
+Operation aborted.
+`,
+			dependents: []string{"flatpak-bash-completion-integration-with-a-long-name", "git-bash-completion"},
+			orphans:    []string{"pkgconf-pkg-config"},
+		},
+		{
+			// What a package replaces is listed under it
+			name: "dnf5",
+			out: "Package                  Arch   Version          Repository      Size\r\n" +
+				"Removing:\r\n" +
+				" bash-completion         noarch 1:2.11-15.fc40   fedora     1.2 MiB\r\n" +
+				"Removing dependent packages:\r\n" +
+				" git-bash-completion     noarch 2.44.0-1.fc40    updates   80.0 KiB\r\n" +
+				"   replacing git-bash-completion noarch 2.43.0-1.fc40 updates 79.0 KiB\r\n" +
+				"\r\n" +
+				"Transaction Summary:\r\n" +
+				" Removing:           2 packages\r\n",
+			dependents: []string{"git-bash-completion"},
+		},
+	}
+	for _, tt := range tests {
+		dependents, orphans := parseDnfRemoveTransaction([]byte(tt.out))
+		if !slices.Equal(dependents, tt.dependents) || !slices.Equal(orphans, tt.orphans) {
+			t.Errorf("%s: dependents %q, orphans %q, want %q and %q", tt.name, dependents, orphans, tt.dependents, tt.orphans)
+		}
+	}
+}
+
+func TestSimulateRemoval(t *testing.T) {
+	tests := []struct {
+		dir           string
+		pkg           Package
+		viaPackageKit bool
+		dependents    []string
+		orphans       []string
+		note          string
+	}{
+		{
+			dir:        "arch",
+			pkg:        Package{Name: "linux", Manager: "pacman"},
+			dependents: []string{"broadcom-wl"},
+			orphans:    []string{"mkinitcpio", "mkinitcpio-busybox"},
+			note:       "fails, as broadcom-wl depend on it; also removes the unneeded mkinitcpio, mkinitcpio-busybox",
+		},
+		{
+			dir:        "fedora",
+			pkg:        Package{Name: "bash-completion", Manager: "rpm/dnf"},
+			dependents: []string{"flatpak-bash-completion-integration-with-a-long-name"},
+			orphans:    []string{"pkgconf-pkg-config"},
+			note:       "also removes flatpak-bash-completion-integration-with-a-long-name; also removes the unneeded pkgconf-pkg-config",
+		},
+		{
+			dir:           "fedora",
+			pkg:           Package{Name: "bash-completion", Manager: "rpm/dnf"},
+			viaPackageKit: true,
+			dependents:    []string{"flatpak-bash-completion-integration-with-a-long-name"},
+			orphans:       []string{"pkgconf-pkg-config"},
+			note:          "fails, as flatpak-bash-completion-integration-with-a-long-name depend on it; leaves pkgconf-pkg-config unneeded",
+		},
+	}
+	for _, tt := range tests {
+		r := fixtureRunner{dir: "testdata/fixtures/" + tt.dir}
+		impact, err := simulateRemoval(context.Background(), r, tt.pkg, tt.viaPackageKit)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pkg.Name, err)
+			continue
+		}
+		if !slices.Equal(impact.Dependents, tt.dependents) || !slices.Equal(impact.Orphans, tt.orphans) {
+			t.Errorf("%s: dependents %q, orphans %q, want %q and %q", tt.pkg.Name, impact.Dependents, impact.Orphans, tt.dependents, tt.orphans)
+		}
+		if note := impact.note(); note != tt.note {
+			t.Errorf("%s: note = %q, want %q", tt.pkg.Name, note, tt.note)
+		}
+	}
+}
+
+// dnf4 only resolves removals for root; other users still see the dependents.
+func TestSimulateDnfRemovalNotRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, ".err", "exit status 1\n", "env", "LC_ALL=C", "dnf", "remove", "--assumeno", "bash-completion")
+	writeFixture(t, dir, ".out", `git-bash-completion\n`+"\n"+`flatpak-bash-completion\n`+"\n",
+		"dnf", "repoquery", "--installed", "--whatrequires", "bash-completion", "--recursive", "--queryformat", `%{name}\n`)
+
+	impact, err := simulateRemoval(context.Background(), fixtureRunner{dir: dir}, Package{Name: "bash-completion", Manager: "rpm/dnf"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"git-bash-completion", "flatpak-bash-completion"}; !slices.Equal(impact.Dependents, want) || impact.Orphans != nil {
+		t.Errorf("dependents %q, orphans %q, want %q and none", impact.Dependents, impact.Orphans, want)
+	}
+	want := "Removing bash-completion affects 2 dependents (git-bash-completion, flatpak-bash-completion). Unneeded dependencies aren't known: dnf only lists the dependencies left unneeded for root."
+	if got := impact.summary(); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+	if got, want := impact.note(), "also removes git-bash-completion, flatpak-bash-completion; unneeded dependencies aren't known"; got != want {
+		t.Errorf("note = %q, want %q", got, want)
+	}
+}
+
+// writeFixture records the output (".out") or error (".err") of a command.
+func writeFixture(t *testing.T, dir, ext, data string, argv ...string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, fixtureName(argv[0], argv[1:]...)+ext), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// repository is a source of packages: an apt source or PPA, a dnf repo, a
+// flatpak remote, a brew tap, a nix channel or flake registry entry, or a
+// guix channel.
+type repository struct {
+	Manager string // key in repo_commands
+	Name    string // what the Remove, Enable and Disable templates take
+	URL     string
+	Enabled bool
+}
+
+// repoLister lists the repositories of the managers using it, like
+// inventoryScanner does for packages.
+type repoLister struct {
+	managers []string
+	argv     []string
+	parse    func([]byte) []repository
+	list     func(context.Context, Runner) ([]repository, error)
+}
+
+var repoListers = []repoLister{
+	{managers: []string{"apt", "dpkg", "dpkg-query"}, argv: []string{"apt-cache", "policy"}, parse: parseAptCachePolicy},
+	{managers: []string{"dnf"}, list: listDnfRepos},
+	{managers: []string{"flatpak", "flatpak-user"}, argv: append([]string{"flatpak"}, flatpakRemotesArgs...), parse: parseFlatpakRemotes},
+	{managers: []string{"brew"}, argv: []string{"brew", "tap-info", "--json", "--installed"}, parse: parseBrewTapInfo},
+	{managers: []string{"nix-env"}, argv: []string{"nix-channel", "--list"}, parse: parseNixChannels},
+	{managers: []string{"nix-profile"}, argv: []string{"nix", "registry", "list"}, parse: parseNixRegistry},
+	{managers: []string{"guix"}, argv: []string{"guix", "describe", "--format=json"}, parse: parseGuixDescribe},
+}
+
+func (l repoLister) run(ctx context.Context, r Runner) ([]repository, error) {
+	if l.list != nil {
+		return l.list(ctx, r)
+	}
+	out, err := r.Output(ctx, l.argv[0], l.argv[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return l.parse(out), nil
+}
+
+// listRepositories lists the repositories of every detected manager, and the
+// managers it failed for.
+func listRepositories(ctx context.Context, r Runner, pms []packageManager) ([]repository, []string) {
+	var repos []repository
+	var failed []string
+	listed := make(map[int]bool, len(repoListers))
+	for _, p := range pms {
+		for i, l := range repoListers {
+			if listed[i] || !slices.Contains(l.managers, p.Name) {
+				continue
+			}
+			listed[i] = true
+			found, err := l.run(ctx, r)
+			if err != nil {
+				failed = append(failed, p.Name)
+				continue
+			}
+			repos = append(repos, found...)
+		}
+	}
+	return repos, failed
+}
+
+// parseAptCachePolicy parses the package files of `apt-cache policy`, one line
+// per suite, component and architecture, e.g.
+//
+//	500 http://archive.ubuntu.com/ubuntu noble-updates/main amd64 Packages
+//
+// into one repository per URL and suite. PPAs are named "ppa:user/name",
+// others are named by their one-line source ("deb URL suite components").
+func parseAptCachePolicy(out []byte) []repository {
+	var repos []repository
+	index := make(map[string]int)
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || line[0] != ' ' || strings.HasPrefix(fields[1], "/") {
+			continue // Header, release or origin line, or the dpkg status file
+		}
+		if _, err := fmt.Sscanf(fields[0], "%d", new(int)); err != nil {
+			continue
+		}
+		uri, suite := fields[1], fields[2]
+		component := ""
+		if s, c, ok := strings.Cut(suite, "/"); ok {
+			suite, component = s, c
+		}
+
+		key := uri + " " + suite
+		i, ok := index[key]
+		if !ok {
+			i = len(repos)
+			index[key] = i
+			repos = append(repos, repository{Manager: "apt", Name: key, URL: uri, Enabled: true})
+		}
+		if component != "" && !slices.Contains(strings.Fields(repos[i].Name), component) {
+			repos[i].Name += " " + component
+		}
+	}
+
+	for i := range repos {
+		if ppa, ok := aptPPA(repos[i].URL); ok {
+			repos[i].Name = ppa
+		} else {
+			repos[i].Name = "deb " + repos[i].Name
+		}
+	}
+	return repos
+}
+
+// aptPPA returns the "ppa:user/name" of a Launchpad PPA URL.
+func aptPPA(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Host != "ppa.launchpad.net" && u.Host != "ppa.launchpadcontent.net") {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return "", false
+	}
+	return "ppa:" + parts[0] + "/" + parts[1], true
+}
+
+// listDnfRepos asks for the enabled and disabled repos separately, since the
+// status column of `dnf repolist --all` is translated.
+func listDnfRepos(ctx context.Context, r Runner) ([]repository, error) {
+	var repos []repository
+	for _, enabled := range []bool{true, false} {
+		flag := "--enabled"
+		if !enabled {
+			flag = "--disabled"
+		}
+		out, err := r.Output(ctx, "dnf", "repolist", flag)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, parseDnfRepolist(out, enabled)...)
+	}
+	return repos, nil
+}
+
+// parseDnfRepolist parses `dnf repolist`: a header, then "id name" per repo.
+func parseDnfRepolist(out []byte, enabled bool) []repository {
+	var repos []repository
+	for i, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) == 0 {
+			continue // Header
+		}
+		repos = append(repos, repository{
+			Manager: "dnf",
+			Name:    fields[0],
+			URL:     strings.Join(fields[1:], " "), // The name, dnf doesn't print the URL
+			Enabled: enabled,
+		})
+	}
+	return repos
+}
+
+// flatpakRemotesArgs lists the remotes of both installations, tab separated.
+var flatpakRemotesArgs = []string{"remotes", "--show-disabled", "--columns=name,url,options"}
+
+// parseFlatpakRemotes parses `flatpak remotes`, whose options are a comma
+// separated list of untranslated words, e.g. "user,disabled".
+func parseFlatpakRemotes(out []byte) []repository {
+	var repos []repository
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if fields[0] == "" {
+			continue
+		}
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		options := strings.Split(fields[2], ",")
+		manager := "flatpak"
+		if slices.Contains(options, "user") {
+			manager = "flatpak-user"
+		}
+		repos = append(repos, repository{
+			Manager: manager,
+			Name:    fields[0],
+			URL:     fields[1],
+			Enabled: !slices.Contains(options, "disabled"),
+		})
+	}
+	return repos
+}
+
+// parseBrewTapInfo parses `brew tap-info --json --installed`.
+func parseBrewTapInfo(out []byte) []repository {
+	var taps []struct {
+		Name   string `json:"name"`
+		Remote string `json:"remote"`
+	}
+	if err := json.Unmarshal(out, &taps); err != nil {
+		return nil
+	}
+	var repos []repository
+	for _, t := range taps {
+		repos = append(repos, repository{Manager: "brew", Name: t.Name, URL: t.Remote, Enabled: true})
+	}
+	return repos
+}
+
+// parseNixChannels parses `nix-channel --list`: "name url" per channel.
+func parseNixChannels(out []byte) []repository {
+	var repos []repository
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		repos = append(repos, repository{Manager: "nix-env", Name: fields[0], URL: fields[1], Enabled: true})
+	}
+	return repos
+}
+
+// parseNixRegistry parses `nix registry list`: "scope flake:name flakeref"
+// per entry, the scope being "user", "system" or "global".
+func parseNixRegistry(out []byte) []repository {
+	var repos []repository
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		repos = append(repos, repository{
+			Manager: "nix-profile",
+			Name:    strings.TrimPrefix(fields[1], "flake:"),
+			URL:     fields[2],
+			Enabled: true,
+		})
+	}
+	return repos
+}
+
+// parseGuixDescribe parses the channels of `guix describe --format=json`.
+func parseGuixDescribe(out []byte) []repository {
+	var channels []struct {
+		Name   string `json:"name"`
+		URL    string `json:"url"`
+		Branch string `json:"branch"`
+	}
+	if err := json.Unmarshal(out, &channels); err != nil {
+		return nil
+	}
+	var repos []repository
+	for _, c := range channels {
+		repos = append(repos, repository{Manager: "guix", Name: c.Name, URL: c.URL, Enabled: true})
+	}
+	return repos
+}
+
+// reposMsg carries the repositories listed for the repositories tab.
+type reposMsg struct {
+	repos  []repository
+	failed []string
+}
+
+func loadRepositories(r Runner, pms []packageManager) tea.Cmd {
+	return func() tea.Msg {
+		repos, failed := listRepositories(context.Background(), r, pms)
+		return reposMsg{repos: repos, failed: failed}
+	}
+}
+
+func (msg reposMsg) status() string {
+	status := fmt.Sprintf("Found %d repositories", len(msg.repos))
+	if len(msg.failed) > 0 {
+		status += " (failed to list " + strings.Join(msg.failed, ", ") + ")"
+	}
+	return status
+}
+
+// repoJob runs an action ("add", "remove", "enable" or "disable") on a
+// repository of a manager through its template.
+func repoJob(r Runner, action string, manager string, name string) tea.Cmd {
+	cmds := repo_commands[managerKey(manager)]
+	dnf5 := managerKey(manager) == "dnf" && isDnf5(r)
+	if dnf5 {
+		cmds = dnf5RepoCommands
+	}
+	template, spec := "", name
+	switch action {
+	case "add":
+		template = cmds.Add
+	case "remove":
+		template = cmds.Remove
+	case "enable":
+		template = cmds.Enable
+		if dnf5 {
+			spec = name + ".enabled=1"
+		}
+	case "disable":
+		template = cmds.Disable
+		if dnf5 {
+			spec = name + ".enabled=0"
+		}
+	}
+	// Reported like a package job, e.g. "Done: enable repository updates-testing"
+	return runJob(r, action+" repository", template, Package{Name: name, Manager: manager}, spec)
+}
+
+// isDnf5 tells whether dnf is dnf5 (Fedora 41 and later), which installs
+// itself as dnf5 too.
+func isDnf5(r Runner) bool {
+	_, err := r.LookPath("dnf5")
+	return err == nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Runner is how lazyinstaller talks to the package managers. Every command
+// and PATH lookup goes through it, so the real package managers can be
+// replaced by recorded fixtures (see fixtureRunner).
+type Runner interface {
+	// Output runs a command and returns its standard output.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Command prepares an interactive command, e.g. one that asks for a
+	// sudo password. It satisfies bubbletea's ExecCommand.
+	Command(ctx context.Context, name string, args ...string) Cmd
+	// LookPath searches for a binary in PATH.
+	LookPath(name string) (string, error)
+}
+
+// Cmd is an interactive command prepared by a Runner.
+type Cmd interface {
+	Run() error
+	SetStdin(io.Reader)
+	SetStdout(io.Writer)
+	SetStderr(io.Writer)
+}
+
+// newRunner returns the runner selected by the environment:
+//
+//	LAZYINSTALLER_FIXTURES=dir  replay the command outputs recorded in dir
+//	LAZYINSTALLER_RECORD=dir    run the real commands and record their outputs in dir
+func newRunner() Runner {
+	if dir := os.Getenv("LAZYINSTALLER_FIXTURES"); dir != "" {
+		return fixtureRunner{dir: dir}
+	}
+	if dir := os.Getenv("LAZYINSTALLER_RECORD"); dir != "" {
+		return recordingRunner{dir: dir, next: execRunner{}}
+	}
+	return execRunner{}
+}
+
+// execRunner runs the real commands.
+type execRunner struct{}
+
+func (execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "TERM=dumb")
+	return cmd.Output()
+}
+
+func (execRunner) Command(ctx context.Context, name string, args ...string) Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return &execCmd{cmd}
+}
+
+func (execRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+type execCmd struct {
+	*exec.Cmd
+}
+
+func (c *execCmd) SetStdin(r io.Reader)  { c.Stdin = r }
+func (c *execCmd) SetStdout(w io.Writer) { c.Stdout = w }
+func (c *execCmd) SetStderr(w io.Writer) { c.Stderr = w }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// inventoryScanner gets the installed packages of a package manager, either
+// by parsing the output of argv or by calling scan.
+// Managers sharing a database (e.g. apt and dpkg) share a scanner.
+type inventoryScanner struct {
+	managers []string // detected manager names that use this scanner
+	title    string   // shown in the status bar
+	argv     []string
+	parse    func([]byte) []Package
+	scan     func(context.Context, Runner) ([]Package, error)
+}
+
+var inventoryScanners = []inventoryScanner{
+	{managers: []string{"apt", "dpkg", "dpkg-query"}, title: "APT/DPKG", argv: append([]string{"dpkg-query"}, dpkgQueryArgs...), parse: parseDpkgQuery},
+	{managers: []string{"snap"}, title: "Snap", scan: scanSnapd},
+	{managers: []string{"flatpak", "flatpak-user"}, title: "Flatpak", scan: scanFlatpak},
+	{managers: []string{"pacman"}, title: "Pacman", argv: append([]string{"env"}, pacmanInfoArgs...), parse: parsePacmanInfo},
+	{managers: []string{"nix-env"}, title: "Nix", argv: append([]string{"nix-env"}, nixEnvQueryArgs...), parse: parseNixEnvJSON},
+	{managers: []string{"nix-profile"}, title: "Nix profile", argv: append([]string{"nix"}, nixProfileListArgs...), parse: parseNixProfileList},
+	{managers: []string{"brew"}, title: "Homebrew", argv: append([]string{"brew"}, brewInfoArgs...), parse: parseBrewInfoJSON},
+	// "active" ensures we only get the currently linked version
+	{managers: []string{"port"}, title: "MacPorts", argv: []string{"port", "installed", "active"}, parse: parsePortInstalled},
+	{managers: []string{"dnf", "rpm"}, title: "RPM", scan: scanRpm},
+	{managers: []string{"guix"}, title: "Guix", argv: []string{"guix", "package", "-I"}, parse: parseGuixInstalled},
+}
+
+func (s inventoryScanner) run(ctx context.Context, r Runner) ([]Package, error) {
+	if s.scan != nil {
+		return s.scan(ctx, r)
+	}
+	out, err := r.Output(ctx, s.argv[0], s.argv[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return s.parse(out), nil
+}
+
+// scanRpm asks dnf5 for JSON, and falls back to the RPM database directly,
+// which works for dnf4 and yum systems alike.
+func scanRpm(ctx context.Context, r Runner) ([]Package, error) {
+	if _, err := r.LookPath("dnf"); err == nil {
+		if out, err := r.Output(ctx, "dnf", dnfRepoqueryArgs...); err == nil {
+			if pkgs := parseDnfRepoqueryJSON(out); len(pkgs) > 0 {
+				// Its JSON has no installed size, the RPM database does
+				if out, err := r.Output(ctx, "rpm", rpmQueryArgs...); err == nil {
+					addSizes(pkgs, parseRpmQuery(out))
+				}
+				return pkgs, nil
+			}
+		}
+	}
+	out, err := r.Output(ctx, "rpm", rpmQueryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	return parseRpmQuery(out), nil
+}
+
+// scanFlatpak lists the applications of every flatpak installation, and the
+// runtimes they use with --runtimes.
+func scanFlatpak(ctx context.Context, r Runner) ([]Package, error) {
+	out, err := r.Output(ctx, "flatpak", flatpakListArgs...)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := parseFlatpakList(out)
+	if showRuntimes {
+		out, err := r.Output(ctx, "flatpak", flatpakRuntimeListArgs...)
+		if err != nil {
+			return nil, err
+		}
+		runtimes := parseFlatpakList(out)
+		for i := range runtimes {
+			runtimes[i].Dependency = true // Installed along with the apps
+		}
+		pkgs = append(pkgs, runtimes...)
+	}
+	return pkgs, nil
+}
+
+// dependencyLister lists the packages of a manager installed automatically,
+// as dependencies, or with explicit the ones the user asked for instead.
+// Other managers tell it along with the installed packages.
+type dependencyLister struct {
+	managers []string
+	key      string
+	argv     []string
+	explicit bool
+}
+
+var dependencyListers = []dependencyLister{
+	{managers: []string{"apt", "dpkg", "dpkg-query"}, key: "apt", argv: []string{"apt-mark", "showauto"}},
+	{managers: []string{"dnf"}, key: "dnf", argv: []string{"dnf", "repoquery", "--userinstalled", "--queryformat", `%{name}\n`}, explicit: true},
+}
+
+// markDependencies sets Dependency on the packages installed automatically.
+func markDependencies(ctx context.Context, r Runner, pms []packageManager, pkgs []Package) {
+	listed := make(map[int]bool, len(dependencyListers))
+	for _, p := range pms {
+		for i, l := range dependencyListers {
+			if listed[i] || !slices.Contains(l.managers, p.Name) {
+				continue
+			}
+			listed[i] = true
+			out, err := r.Output(ctx, l.argv[0], l.argv[1:]...)
+			if err != nil {
+				continue
+			}
+			names := make(map[string]bool)
+			for _, n := range parseDepNames(out) {
+				names[n.Name] = true
+			}
+			for j := range pkgs {
+				if managerKey(pkgs[j].Manager) != l.key {
+					continue
+				}
+				// dpkg qualifies some names with their arch, apt-mark only foreign ones
+				name, _, _ := strings.Cut(pkgs[j].Name, ":")
+				pkgs[j].Dependency = (names[pkgs[j].Name] || names[name]) != l.explicit
+			}
+		}
+	}
+}
+
+func findScanner(manager string) (int, bool) {
+	for i, s := range inventoryScanners {
+		for _, m := range s.managers {
+			if m == manager {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// scanPackages collects the installed packages of every detected package
+// manager, and returns them along with a status message for the last scan.
+func scanPackages(r Runner, pms []packageManager) ([]Package, string) {
+	ctx := context.Background()
+	status := ""
+
+	pkgs := []Package{}
+
+	scanned := make(map[int]bool, len(inventoryScanners))
+
+	for _, p := range pms {
+		i, ok := findScanner(p.Name)
+		if !ok {
+			status = "Unsupported package manager"
+			continue
+		}
+		if scanned[i] {
+			continue
+		}
+		scanned[i] = true
+
+		s := inventoryScanners[i]
+		found, err := s.run(ctx, r)
+		if err != nil {
+			status = "Failed to get " + s.title + " packages"
+			continue
+		}
+		pkgs = append(pkgs, found...)
+		status = "Successfully got " + s.title + " packages"
+	}
+
+	if own, err := loadHoldFile(); err == nil {
+		markHeld(pkgs, own, true)
+	}
+	markHeld(pkgs, scanHolds(ctx, r, pms), false)
+	markDependencies(ctx, r, pms, pkgs)
+
+	return pkgs, status
+}
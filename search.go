@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+)
+
+// maxAptResults limits how many apt search results get their versions looked up.
+const maxAptResults = 200
+
+// searchApt searches package names with apt-cache and looks up their
+// versions with dpkg-query (installed) and apt-cache show (candidate). Unlike
+// `apt search`, these have a stable output that isn't translated.
+func searchApt(ctx context.Context, r Runner, query string) ([]Package, error) {
+	out, err := r.Output(ctx, "apt-cache", "search", "--names-only", query)
+	if err != nil {
+		return nil, err
+	}
+	names := parseAptCacheSearch(out)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if len(names) > maxAptResults {
+		names = names[:maxAptResults]
+	}
+
+	// dpkg-query fails if any of the names is unknown to dpkg, but still
+	// prints the others
+	installed := make(map[string]string)
+	out, _ = r.Output(ctx, "dpkg-query", append(dpkgQueryArgs, names...)...)
+	for _, p := range parseDpkgQuery(out) {
+		installed[p.Name] = p.Version
+	}
+
+	out, _ = r.Output(ctx, "apt-cache", append([]string{"show", "--no-all-versions"}, names...)...)
+	candidates := parseAptCacheShow(out)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pkgs := make([]Package, 0, len(names))
+	for _, name := range names {
+		version, ok := installed[name]
+		if !ok {
+			version = candidates[name]
+		}
+		pkgs = append(pkgs, Package{
+			Name:        name,
+			Version:     version,
+			Manager:     "apt/dpkg",
+			IsInstalled: ok,
+		})
+	}
+	return pkgs, nil
+}
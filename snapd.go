@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// snapdSocket is where snapd serves its REST API, the one the snap command uses.
+const snapdSocket = "/run/snapd.socket"
+
+// snapdTransporter is implemented by runners that stand in for snapd, like
+// fixtureRunner, so snapd is replaced along with the package managers.
+type snapdTransporter interface {
+	SnapdTransport() http.RoundTripper
+}
+
+type snapdClient struct {
+	http *http.Client
+}
+
+func newSnapdClient(r Runner) *snapdClient {
+	var transport http.RoundTripper
+	if t, ok := r.(snapdTransporter); ok {
+		transport = t.SnapdTransport()
+	} else {
+		transport = unixSocketTransport(snapdSocket)
+	}
+	return &snapdClient{http: &http.Client{Transport: transport}}
+}
+
+func unixSocketTransport(socket string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+}
+
+// snapdResponse is the envelope of every snapd response.
+type snapdResponse struct {
+	Type       string          `json:"type"` // "sync", "async" or "error"
+	StatusCode int             `json:"status-code"`
+	Result     json.RawMessage `json:"result"`
+	Change     string          `json:"change"` // ID of the change started by an async request
+}
+
+type snapdError struct {
+	Message    string `json:"message"`
+	Kind       string `json:"kind"`
+	StatusCode int    `json:"-"`
+}
+
+func (e *snapdError) Error() string {
+	return "snapd: " + e.Message
+}
+
+// accessDenied tells whether snapd refused a request because the user is
+// neither root nor authorized by polkit.
+func (e *snapdError) accessDenied() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden ||
+		e.Kind == "login-required" || e.Kind == "auth-cancelled"
+}
+
+// do calls the API and decodes the result of a successful response into v.
+// It returns the change ID of async requests.
+func (c *snapdClient) do(ctx context.Context, method, path string, body any, v any) (string, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, reqBody)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		// Let polkit ask for authorization, like `snap install` does
+		req.Header.Set("X-Allow-Interaction", "true")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return decodeSnapdResponse(data, v)
+}
+
+func (c *snapdClient) get(ctx context.Context, path string, v any) error {
+	_, err := c.do(ctx, http.MethodGet, path, nil, v)
+	return err
+}
+
+func decodeSnapdResponse(body []byte, v any) (string, error) {
+	var r snapdResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", fmt.Errorf("snapd: %w", err)
+	}
+	if r.Type == "error" {
+		e := &snapdError{StatusCode: r.StatusCode}
+		if err := json.Unmarshal(r.Result, e); err != nil || e.Message == "" {
+			return "", fmt.Errorf("snapd: status %d", r.StatusCode)
+		}
+		return "", e
+	}
+	if v == nil || len(r.Result) == 0 || string(r.Result) == "null" {
+		return r.Change, nil
+	}
+	return r.Change, json.Unmarshal(r.Result, v)
+}
+
+// snapdSnap is a snap as described by the API, installed or from the store.
+type snapdSnap struct {
+	Name        string                  `json:"name"`
+	Summary     string                  `json:"summary"`
+	Version     string                  `json:"version"`
+	Revision    string                  `json:"revision"`
+	Channel     string                  `json:"channel"`
+	Confinement string                  `json:"confinement"`
+	Type        string                  `json:"type"`
+	Status      string                  `json:"status"` // "active" once installed
+	Hold        string                  `json:"hold"`   // Time until which refreshes are held, if held
+	Channels    map[string]snapdChannel `json:"channels"`
+}
+
+type snapdChannel struct {
+	Version     string `json:"version"`
+	Revision    string `json:"revision"`
+	Confinement string `json:"confinement"`
+}
+
+func (s snapdSnap) pkg(installed bool) Package {
+	return Package{
+		Name:        s.Name,
+		Version:     s.Version,
+		Manager:     "snap",
+		IsInstalled: installed,
+		Held:        installed && s.Hold != "",
+		// Bases and snapd itself come with the apps that use them
+		Dependency: installed && (s.Type == "base" || s.Type == "os" || s.Type == "snapd"),
+	}
+}
+
+// list returns the installed snaps.
+func (c *snapdClient) list(ctx context.Context) ([]Package, error) {
+	snaps, err := c.installed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make([]Package, 0, len(snaps))
+	for _, s := range snaps {
+		pkgs = append(pkgs, s.pkg(true))
+	}
+	sortPackages(pkgs)
+	return pkgs, nil
+}
+
+func (c *snapdClient) installed(ctx context.Context) ([]snapdSnap, error) {
+	var snaps []snapdSnap
+	err := c.get(ctx, "/v2/snaps", &snaps)
+	return snaps, err
+}
+
+// find searches the store. Snaps that are installed are marked so.
+func (c *snapdClient) find(ctx context.Context, query string) ([]Package, error) {
+	var found []snapdSnap
+	if err := c.get(ctx, "/v2/find?q="+url.QueryEscape(query), &found); err != nil {
+		var e *snapdError
+		if errors.As(err, &e) && e.Kind == "snap-not-found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	installed := make(map[string]Package)
+	if pkgs, err := c.list(ctx); err == nil {
+		for _, p := range pkgs {
+			installed[p.Name] = p
+		}
+	}
+
+	pkgs := make([]Package, 0, len(found))
+	for _, s := range found {
+		p, ok := installed[s.Name]
+		if !ok {
+			p = s.pkg(false)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// refreshable returns the installed snaps with a newer revision in their
+// channel, as described by the store.
+func (c *snapdClient) refreshable(ctx context.Context) ([]snapdSnap, error) {
+	var snaps []snapdSnap
+	if err := c.get(ctx, "/v2/find?select=refresh", &snaps); err != nil {
+		var e *snapdError
+		if errors.As(err, &e) && e.Kind == "snap-not-found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return snaps, nil
+}
+
+// info describes a snap from the store, including its channels.
+func (c *snapdClient) info(ctx context.Context, name string) (snapdSnap, error) {
+	var found []snapdSnap
+	if err := c.get(ctx, "/v2/find?name="+url.QueryEscape(name), &found); err != nil {
+		return snapdSnap{}, err
+	}
+	if len(found) == 0 {
+		return snapdSnap{}, fmt.Errorf("snap %q not found", name)
+	}
+	return found[0], nil
+}
+
+// confinement looks up how a snap is confined in the store: "strict",
+// "classic" or "devmode". With a channel, it's the confinement of the
+// revision in that channel.
+func (c *snapdClient) confinement(ctx context.Context, name, channel string) (string, error) {
+	info, err := c.info(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if ch, ok := info.Channels[channel]; ok && ch.Confinement != "" {
+		return ch.Confinement, nil
+	}
+	return info.Confinement, nil
+}
+
+// snapConfinementFlag returns the flag `snap install` needs for a snap of
+// the confinement, if any.
+func snapConfinementFlag(confinement string) string {
+	switch confinement {
+	case "classic":
+		return "--classic"
+	case "devmode":
+		return "--devmode"
+	}
+	return ""
+}
+
+// snapdAction is the body of a POST /v2/snaps/<name> request.
+type snapdAction struct {
+	Action  string `json:"action"` // "install", "remove" or "refresh"
+	Channel string `json:"channel,omitempty"`
+	Classic bool   `json:"classic,omitempty"`
+	DevMode bool   `json:"devmode,omitempty"`
+}
+
+// spec returns the snap name with the flags of the action, for the command
+// templates, e.g. "code --classic".
+func (a snapdAction) spec(name string) string {
+	if a.Channel != "" {
+		name += " --channel=" + a.Channel
+	}
+	if a.Classic {
+		name += " --classic"
+	}
+	if a.DevMode {
+		name += " --devmode"
+	}
+	return name
+}
+
+// act starts installing, removing or refreshing a snap, and returns the ID
+// of the change to follow with change.
+func (c *snapdClient) act(ctx context.Context, name string, action snapdAction) (string, error) {
+	id, err := c.do(ctx, http.MethodPost, "/v2/snaps/"+url.PathEscape(name), action, nil)
+	if err == nil && id == "" {
+		err = errors.New("snapd: no change ID in response")
+	}
+	return id, err
+}
+
+// snapdChange is the progress of an async operation.
+type snapdChange struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	Status  string `json:"status"` // "Do", "Doing", "Done", "Error", ...
+	Ready   bool   `json:"ready"`
+	Err     string `json:"err"`
+	Tasks   []struct {
+		Summary  string `json:"summary"`
+		Status   string `json:"status"`
+		Progress struct {
+			Label string `json:"label"`
+			Done  int64  `json:"done"`
+			Total int64  `json:"total"`
+		} `json:"progress"`
+	} `json:"tasks"`
+}
+
+func (c *snapdClient) change(ctx context.Context, id string) (snapdChange, error) {
+	var ch snapdChange
+	err := c.get(ctx, "/v2/changes/"+url.PathEscape(id), &ch)
+	return ch, err
+}
+
+// failure is the error of a change that is ready but not done, e.g.
+// "snapd: change 42 is Undone" if snapd gave no reason.
+func (ch snapdChange) failure() error {
+	if msg := strings.TrimSpace(ch.Err); msg != "" {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("snapd: change %s is %s", ch.ID, ch.Status)
+}
+
+// progress describes the running task, e.g. "Download snap "firefox" 42%".
+func (ch snapdChange) progress() string {
+	for _, t := range ch.Tasks {
+		if t.Status != "Doing" {
+			continue
+		}
+		if t.Progress.Total > 1 {
+			return fmt.Sprintf("%s %d%%", t.Summary, t.Progress.Done*100/t.Progress.Total)
+		}
+		return t.Summary
+	}
+	return ch.Summary
+}
+
+// scanSnapd lists the installed snaps, with the size of the file of their
+// current revision, which stays compressed once installed.
+func scanSnapd(ctx context.Context, r Runner) ([]Package, error) {
+	snaps, err := newSnapdClient(r).installed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(snaps))
+	for i, s := range snaps {
+		paths[i] = s.file()
+	}
+	sizes, _ := duSizes(ctx, r, paths)
+	pkgs := make([]Package, 0, len(snaps))
+	for _, s := range snaps {
+		p := s.pkg(true)
+		p.Size = sizes[s.file()]
+		pkgs = append(pkgs, p)
+	}
+	sortPackages(pkgs)
+	return pkgs, nil
+}
+
+// file is where snapd keeps the installed revision of a snap, mounted on
+// /snap/NAME/REVISION.
+func (s snapdSnap) file() string {
+	return "/var/lib/snapd/snaps/" + s.Name + "_" + s.Revision + ".snap"
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// socketRunner talks to a snapd served on socket, and replays the rest
+// from the ubuntu fixtures.
+type socketRunner struct {
+	fixtureRunner
+	socket string
+}
+
+func (r socketRunner) SnapdTransport() http.RoundTripper {
+	return unixSocketTransport(r.socket)
+}
+
+// serveSnapd serves handler on a Unix socket, as snapd does.
+func serveSnapd(t *testing.T, handler http.Handler) socketRunner {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "snapd.socket")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("no Unix sockets:", err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socketRunner{fixtureRunner: fixtureRunner{dir: "testdata/fixtures/ubuntu"}, socket: socket}
+}
+
+func writeSnapd(w http.ResponseWriter, status int, resp map[string]any) {
+	resp["status-code"] = status
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// The installed snaps are those of the ubuntu fixture, served by snapd.
+func TestSnapdList(t *testing.T) {
+	body, err := os.ReadFile("testdata/fixtures/ubuntu/snapd_GET__v2_snaps.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := serveSnapd(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.URL.Path != "/v2/snaps" {
+			writeSnapd(w, http.StatusNotFound, map[string]any{"type": "error", "result": map[string]any{"message": "not found"}})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+
+	pkgs, err := scanSnapd(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sizes come from the du fixture
+	want := []Package{
+		{Name: "code", Manager: "snap", Version: "1.87.2 (beta)", IsInstalled: true, Size: 328704 * 1024},
+		{Name: "core22", Manager: "snap", Version: "20240111", IsInstalled: true, Dependency: true, Size: 75648 * 1024},
+		{Name: "firefox", Manager: "snap", Version: "123.0-2", IsInstalled: true, Held: true, Size: 260096 * 1024},
+		{Name: "snapd", Manager: "snap", Version: "2.61.2", IsInstalled: true, Dependency: true, Size: 39552 * 1024},
+	}
+	if !slices.Equal(pkgs, want) {
+		t.Errorf("got %+v\nwant %+v", pkgs, want)
+	}
+}
+
+// An install is followed through the change snapd starts, until it's done.
+func TestSnapdInstallChange(t *testing.T) {
+	var polls atomic.Int32
+	r := serveSnapd(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/v2/snaps/code":
+			var a snapdAction
+			if err := json.NewDecoder(req.Body).Decode(&a); err != nil || a != (snapdAction{Action: "install", Classic: true}) {
+				writeSnapd(w, http.StatusBadRequest, map[string]any{"type": "error", "result": map[string]any{"message": "bad action"}})
+				return
+			}
+			writeSnapd(w, http.StatusAccepted, map[string]any{"type": "async", "change": "7"})
+		case req.Method == http.MethodGet && req.URL.Path == "/v2/changes/7":
+			status := "Doing"
+			if polls.Add(1) > 1 {
+				status = "Done"
+			}
+			writeSnapd(w, http.StatusOK, map[string]any{"type": "sync", "result": map[string]any{
+				"id": "7", "status": status, "ready": status == "Done",
+				"tasks": []map[string]any{{
+					"summary": `Download snap "code"`, "status": status,
+					"progress": map[string]any{"done": 42, "total": 100},
+				}},
+			}})
+		default:
+			writeSnapd(w, http.StatusNotFound, map[string]any{"type": "error", "result": map[string]any{"message": "not found"}})
+		}
+	}))
+
+	pkg := Package{Name: "code", Manager: "snap"}
+	msg := snapJob(r, "install", pkg, snapdAction{Action: "install", Classic: true})()
+	var statuses []string
+	for range 3 {
+		change, ok := msg.(snapdChangeMsg)
+		if !ok {
+			break
+		}
+		status, cmd := handleSnapdChange(r, change)
+		statuses = append(statuses, status)
+		msg = cmd()
+	}
+
+	want := []string{"snap: install code...", `snap: Download snap "code" 42%`, ""}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("statuses = %q, want %q", statuses, want)
+	}
+	if done, ok := msg.(jobDoneMsg); !ok || done.err != nil {
+		t.Errorf("last message = %+v, want a successful jobDoneMsg", msg)
+	}
+}
+
+// When snapd refuses the user, the job falls back to sudo and the template.
+func TestSnapdAccessDenied(t *testing.T) {
+	r := serveSnapd(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeSnapd(w, http.StatusUnauthorized, map[string]any{"type": "error", "result": map[string]any{
+			"message": "access denied", "kind": "login-required",
+		}})
+	}))
+
+	pkg := Package{Name: "code", Manager: "snap", IsInstalled: true}
+	msg := snapJob(r, "uninstall", pkg, snapdAction{Action: "remove"})()
+	change, ok := msg.(snapdChangeMsg)
+	if !ok {
+		t.Fatalf("got %T, want snapdChangeMsg", msg)
+	}
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	status, cmd := handleSnapdChange(r, change)
+	if !strings.Contains(status, "sudo") {
+		t.Errorf("status = %q, want a retry with sudo", status)
+	}
+	if done, ok := cmd().(jobDoneMsg); !ok || formatArgv(done.argv) != "sudo snap remove code" {
+		t.Errorf("retried with %+v, want sudo snap remove code", done)
+	}
+}
+
+// A change that ends without being done fails with its status, if snapd
+// gives no error.
+func TestSnapdChangeFailure(t *testing.T) {
+	r := fixtureRunner{dir: "testdata/fixtures/ubuntu"}
+	tests := []struct {
+		change snapdChange
+		want   string
+	}{
+		{snapdChange{ID: "7", Status: "Error", Ready: true, Err: "cannot install \"code\": no space left\n"}, `cannot install "code": no space left`},
+		{snapdChange{ID: "7", Status: "Undone", Ready: true}, "snapd: change 7 is Undone"},
+	}
+	for _, tt := range tests {
+		_, cmd := handleSnapdChange(r, snapdChangeMsg{action: "install", pkg: Package{Name: "code", Manager: "snap"}, id: "7", change: tt.change})
+		done, ok := cmd().(jobDoneMsg)
+		if !ok || done.err == nil || done.err.Error() != tt.want {
+			t.Errorf("%s: got %+v, want the error %q", tt.change.Status, done, tt.want)
+		}
+	}
+}
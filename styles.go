@@ -22,6 +22,9 @@ var (
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(inactiveBorderColor)
 
+	headerStyle = lipgloss.NewStyle().
+			Bold(true)
+
 	// Navigation styles
 	selectedItemStyle = lipgloss.NewStyle().
 				Background(lipgloss.Color("62")).
@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
 )
 
 type searchResultMsg struct {
@@ -20,8 +21,21 @@ type searchResultMsg struct {
 
 type searchErrorMsg error
 
+const searchPlaceholder = "Search packages, or filter with mgr:snap installed:yes upgradable:yes explicit:yes size:>100M..."
+
+// The TUI has four tabs: packages, repositories (Ctrl+T), clean up (Ctrl+L)
+// and disk usage (Ctrl+U). Each opens from the packages tab, and the same key
+// or Ctrl+T goes back to it.
+const (
+	packagesTab = iota
+	reposTab
+	cleanupTab
+	usageTab
+)
+
 type model struct {
 	textInput    textinput.Model
+	inventory    []Package // Installed packages found at startup
 	packages     []Package
 	filtered     []Package
 	status       string
@@ -32,24 +46,64 @@ type model struct {
 	height       int
 	searchCtx    context.Context
 	searchCancel context.CancelFunc
+	pkgMap       *packageMap
+	runner       Runner
+	packageKit   *packageKitClient // nil unless using PackageKit
+	managers     []packageManager
+	tab          int
+	repos        []repository // Listed when the repositories tab is first shown
+	reposLoaded  bool
+	repoCursor   int
+	cleanup      []cleanupItem                // Listed each time the clean up tab is shown
+	cleanupAt    int                          // Index of the selected item in the clean up tab
+	layout       listLayout                   // Columns and order of the package list
+	columnPicker *columnPicker                // Shown over the list while choosing the columns
+	header       string                       // Column titles above the package list
+	filter       packageFilter                // Facets of the query, applied to the listed packages
+	searched     string                       // Words of the query last searched for
+	upgrades     map[string]map[string]string // Upgradable packages by manager key, nil until checked
+	checking     bool                         // Upgrades are being checked
+	query        string                       // Search query, kept while the input is used to add a repository
+	picker       *versionPicker               // Shown over the list while choosing a version
+	deps         *depTree                     // Shown over the list while looking at dependencies
+	confirm      tea.Cmd                      // Job waiting for the user to confirm the prompt in the status bar
+	impact       *removalImpact               // Shown over the list while confirming a removal
+	help         bool                         // Keys shown over the list
+	rows         *listRows                    // Formatted rows of filtered, nil once they change
+	listTop      int                          // First of filtered in view
 }
 
-func initialModel(pkgs []Package, status string) model {
+func initialModel(r Runner, pk *packageKitClient, pms []packageManager, pkgs []Package, status string) model {
 	ti := textinput.New()
-	ti.Placeholder = "Search packages..."
+	ti.Placeholder = searchPlaceholder
 	ti.Focus()
 	ti.CharLimit = 156
 	ti.Width = 20
 
 	vp := viewport.New(80, 20)
 
+	pkgMap, err := loadPackageMap()
+	if err != nil {
+		status = "Failed to load package mappings: " + err.Error()
+	}
+	layout, err := loadLayout()
+	if err != nil {
+		status = "Failed to load the list layout: " + err.Error()
+	}
+
 	return model{
-		textInput: ti,
-		packages:  pkgs,
-		filtered:  pkgs,
-		status:    status,
-		viewport:  vp,
-		cursor:    0,
+		runner:     r,
+		packageKit: pk,
+		managers:   pms,
+		pkgMap:     pkgMap,
+		textInput:  ti,
+		inventory:  pkgs,
+		packages:   pkgs,
+		filtered:   layout.sort(pkgs),
+		layout:     layout,
+		status:     status,
+		viewport:   vp,
+		cursor:     0,
 	}
 }
 
@@ -59,145 +113,841 @@ func (m model) Init() tea.Cmd {
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
+	keyHandled := false // Keys used by the TUI itself are not passed to the text input
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
+		if m.confirm != nil {
+			// Enter confirms, any other key cancels
+			keyHandled = true
+			if key.Matches(msg, keys.Confirm) {
+				cmd = m.confirm
+				m.status = "Starting..."
+			} else {
+				m.status = "Cancelled"
+			}
+			m.confirm, m.impact = nil, nil
+			break
+		}
+		if key.Matches(msg, keys.Quit) {
 			return m, tea.Quit
-		case tea.KeyUp:
-			if m.cursor > 0 {
-				m.cursor--
+		}
+		if m.help {
+			keyHandled = true
+			if key.Matches(msg, keys.Help, keys.Close) {
+				m.help = false
+				m.status = "Ready"
+			} else {
+				m.navigate(msg)
+			}
+			break
+		}
+		if key.Matches(msg, keys.Help) && !(m.typing() && msg.Type == tea.KeyRunes) {
+			keyHandled = true
+			m.help = true
+			m.viewport.GotoTop()
+			m.status = "Keys of every part of the TUI"
+			break
+		}
+		if m.navigate(msg) {
+			keyHandled = true
+			break
+		}
+		if m.picker != nil {
+			cmd, keyHandled = m.updatePicker(msg), true
+			break
+		}
+		if m.deps != nil {
+			cmd, keyHandled = m.updateDeps(msg), true
+			break
+		}
+		if m.columnPicker != nil {
+			keyHandled = true
+			m.updateColumns(msg)
+			break
+		}
+		if key.Matches(msg, keys.Focus) {
+			keyHandled = true
+			if m.textInput.Focused() {
+				m.textInput.Blur()
+			} else {
+				cmd = m.textInput.Focus()
+			}
+			break
+		}
+		if key.Matches(msg, keys.Escape) {
+			keyHandled = true
+			if !m.textInput.Focused() && (m.tab == packagesTab || m.tab == reposTab) {
+				cmd = m.textInput.Focus()
+			} else {
+				m.status = "Press Enter to quit, any other key to cancel"
+				m.confirm = tea.Quit
+			}
+			break
+		}
+		if m.tab == reposTab {
+			cmd, keyHandled = m.updateRepos(msg)
+			break
+		}
+		if m.tab == cleanupTab {
+			cmd, keyHandled = m.updateCleanup(msg)
+			break
+		}
+		if m.tab == usageTab {
+			cmd, keyHandled = m.updateUsage(msg)
+			break
+		}
+		switch {
+		case key.Matches(msg, keys.Repos):
+			keyHandled = true
+			cmd = m.switchTab(reposTab)
+		case key.Matches(msg, keys.Cleanup):
+			keyHandled = true
+			cmd = m.switchTab(cleanupTab)
+		case key.Matches(msg, keys.Usage):
+			keyHandled = true
+			cmd = m.switchTab(usageTab)
+		case key.Matches(msg, keys.Sort, keys.Reverse):
+			keyHandled = true
+			if key.Matches(msg, keys.Sort) {
+				m.layout.nextSort()
+			} else if m.layout.SortBy != "" {
+				m.layout.Descending = !m.layout.Descending
+			}
+			m.refilter()
+			m.status = m.layout.sortStatus()
+			m.saveLayout()
+		case key.Matches(msg, keys.Columns):
+			keyHandled = true
+			m.columnPicker = &columnPicker{}
+			m.status = "Columns of the package list"
+		case key.Matches(msg, keys.Install):
+			keyHandled = true
+			if pkg, ok := m.selected(); ok {
+				action, verb := "install", "Install"
+				if pkg.IsInstalled {
+					action, verb = "upgrade", "Upgrade"
+				}
+				job := packageJob(m.runner, m.packageKit, action, pkg)
+				switch command := jobCommand(m.packageKit, action, pkg); {
+				case pkg.Held && action == "upgrade":
+					m.status = pkg.Name + " is held, unhold it with Ctrl+P to upgrade it"
+				case command == "":
+					cmd = job // Reports that it's not supported
+				default:
+					m.status = fmt.Sprintf("%s %s with %s? Press Enter to run it, any other key to cancel", verb, pkg.Name, command)
+					m.confirm = job
+				}
+			}
+		case key.Matches(msg, keys.Remove):
+			keyHandled = true
+			if pkg, ok := m.selected(); ok && pkg.IsInstalled {
+				if _, ok := removalSimulators[managerKey(pkg.Manager)]; ok {
+					m.status = "Checking what removing " + pkg.Name + " affects..."
+					cmd = loadRemovalImpact(m.runner, pkg, m.packageKit != nil && m.packageKit.handles(pkg.Manager))
+				} else {
+					cmd = packageJob(m.runner, m.packageKit, "uninstall", pkg)
+				}
+			}
+		case key.Matches(msg, keys.InstallFile):
+			keyHandled = true
+			if path := strings.TrimSpace(m.textInput.Value()); path != "" {
+				m.status = "Reading " + path + "..."
+				cmd = loadPackageFile(m.runner, m.managers, path)
+			} else {
+				m.status = "Type the path of a package file to install, then press Ctrl+O"
+			}
+		case key.Matches(msg, keys.Versions):
+			keyHandled = true
+			if pkg, ok := m.selected(); ok {
+				m.status = "Listing the versions of " + pkg.Name + "..."
+				cmd = loadVersions(m.runner, pkg)
+			}
+		case key.Matches(msg, keys.Dependencies):
+			keyHandled = true
+			if pkg, ok := m.selected(); ok {
+				m.deps = newDepTree(pkg)
+				cmd = m.deps.expand(m.runner, m.deps.root())
+				m.status = m.deps.status()
 			}
-		case tea.KeyDown:
-			if m.cursor < len(m.filtered)-1 {
-				m.cursor++
+		case key.Matches(msg, keys.Hold):
+			keyHandled = true
+			if pkg, ok := m.selected(); ok && pkg.IsInstalled {
+				action := "hold"
+				if pkg.Held {
+					action = "unhold"
+				}
+				cmd = holdJob(m.runner, action, pkg)
 			}
+		case key.Matches(msg, keys.DryRun):
+			keyHandled = true
+			m.toggleDryRun()
+		case key.Matches(msg, keys.Export):
+			path := "lazyinstaller-" + time.Now().Format("20060102-150405") + ".json"
+			if err := exportToFile(path, m.inventory); err != nil {
+				m.status = "Export failed: " + err.Error()
+			} else {
+				m.status = fmt.Sprintf("Exported %d packages to %s", len(m.inventory), path)
+			}
+		case key.Matches(msg, keys.FindElsewhere):
+			m.status = m.findElsewhere()
 		}
+	case tea.MouseMsg:
+		m.updateMouse(msg)
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 
 		// Update viewport size
 		vpWidth := max(msg.Width-2, 0)
-		vpHeight := max(msg.Height-9, 0)
+		vpHeight := max(msg.Height-10, 0) // A line is kept for the column titles
 
 		m.viewport.Width = vpWidth
 		m.viewport.Height = vpHeight
 
 		// Update text input width
 		m.textInput.Width = max(vpWidth-2, 0)
+	case snapConfinementMsg:
+		status, prompt, job := handleSnapConfinement(m.runner, msg)
+		if prompt != "" {
+			m.status, m.confirm = prompt, job
+		} else {
+			if status != "" {
+				m.status = status
+			}
+			cmd = job
+		}
+	case snapdChangeMsg:
+		var status string
+		status, cmd = handleSnapdChange(m.runner, msg)
+		if status != "" {
+			m.status = status
+		}
+	case packageKitMsg:
+		m.status = msg.status()
+		cmd = waitPackageKit(msg.updates)
+	case packageFileMsg:
+		if msg.err != nil {
+			m.status = "Can't install the file: " + msg.err.Error()
+		} else {
+			m.status = msg.file.describe() + ". Press Enter to install it with " + msg.manager + ", any other key to cancel"
+			m.confirm = fileJob(m.runner, msg.file, msg.manager)
+		}
+	case removalImpactMsg:
+		m.confirm = packageJob(m.runner, m.packageKit, "uninstall", msg.pkg)
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Couldn't check what removing %s affects: %v. Press Enter to remove it anyway, any other key to cancel", msg.pkg.Name, msg.err)
+		} else {
+			m.impact = &msg.impact
+			m.status = msg.impact.summary() + " Press Enter to remove it, any other key to cancel"
+		}
+	case depsMsg:
+		if m.deps != nil && m.deps.loading == msg.node {
+			m.status = m.deps.loaded(msg)
+		}
+	case versionsMsg:
+		switch {
+		case msg.err != nil:
+			m.status = "Failed to list versions: " + msg.err.Error()
+		case len(msg.versions) == 0:
+			m.status = "No versions found for " + msg.pkg.Name
+		default:
+			m.picker = &versionPicker{pkg: msg.pkg, versions: msg.versions}
+			m.status = fmt.Sprintf("%d versions of %s", len(msg.versions), msg.pkg.Name)
+		}
+	case upgradesMsg:
+		m.upgrades, m.checking = msg.upgrades, false
+		markUpgrades(m.inventory, m.upgrades)
+		markUpgrades(m.packages, m.upgrades)
+		m.refilter()
+		m.status = m.filterStatus()
+	case cleanupMsg:
+		m.cleanup = msg.items
+		m.cleanupAt = min(m.cleanupAt, max(len(m.cleanup)-1, 0))
+		m.status = msg.status()
+	case reposMsg:
+		m.repos = msg.repos
+		m.reposLoaded = true
+		m.repoCursor = min(m.repoCursor, max(len(m.repos)-1, 0))
+		m.status = msg.status()
+	case jobDoneMsg:
+		m.status = msg.status()
+		if m.tab == reposTab && msg.err == nil && !msg.dryRun {
+			cmd = loadRepositories(m.runner, m.managers)
+		}
+		if m.tab == cleanupTab && !msg.dryRun {
+			cmd = loadCleanup(m.runner, m.managers)
+		}
+		if msg.err == nil && !msg.dryRun {
+			switch msg.action {
+			case "install":
+				m.setInstalled(msg.pkg, true)
+			case "uninstall":
+				m.setInstalled(msg.pkg, false)
+			case "hold", "unhold":
+				m.setHeld(msg.pkg, msg.action == "hold")
+			case "upgrade":
+				m.setUpgraded(msg.pkg)
+			}
+		}
 	}
 
 	// Update text input
-	var tiCmd tea.Cmd
-	m.textInput, tiCmd = m.textInput.Update(msg)
-	cmd = tea.Batch(cmd, tiCmd)
+	if !keyHandled {
+		var tiCmd tea.Cmd
+		m.textInput, tiCmd = m.textInput.Update(msg)
+		cmd = tea.Batch(cmd, tiCmd)
+	}
 
-	// If text input changed, trigger search
+	// Search again after typing; the managers are only asked when the words
+	// of the query change, as search compares them with m.searched
 	query := m.textInput.Value()
 
-	// We check if the query changed.
-	// Note: We need to store the "last query" to know if it changed.
-	// But simply checking against the current results isn't enough.
-	// For now, we can rely on the fact that if we get a KeyMsg that isn't navigation, it might be text.
-	// Or we can just check if we are in a "Searching" state?
-	// Actually, let's just use a simple heuristic: if the message is a KeyMsg (and not navigation), we assume input *might* have changed.
-	// Better yet, we can check if the model's query matches the last one? No, we don't store "last query".
-	// Let's just cancel and restart if it's a typing event?
-	// The best way is to check `textInput.Value()` vs a stored value, but `m` is value receiver in some places (standard Bubble Tea).
-	// But `Update` returns `m`. So we can't easily store "previous" unless we add it to struct.
-	// However, `textInput.Update` handles the change.
-
-	// Let's trigger search on every KeyMsg that is a text character.
-	// Or simplistic: Just fire it?
-	// Proper way: Add `lastQuery` to model?
-	// For now, let's just trigger it. The context cancellation handles the "agility".
-
-	// Actually, let's look at the previous attempt:
-	// `if m.textInput.Value() != query` -> query was defined as `m.textInput.Value()` so that is always false!
-	// We need to compare to something else.
-
-	// To fix the "jittery" issue, we MUST cancel the old context.
-	// We will assume that strictly speaking, we want to search if the input is not empty.
-	// But we don't want to re-search if nothing changed.
-	// Since we don't track `lastQuery`, let's just do it if `msg` is likely to have changed text.
-
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		// If it's a key message and NOT navigation/special, it's likely text.
+		if keyHandled || m.tab != packagesTab {
+			break
+		}
 		if msg.Type == tea.KeyRunes || msg.Type == tea.KeyBackspace || msg.Type == tea.KeyDelete {
-			if m.searchCancel != nil {
-				m.searchCancel()
-			}
-			var ctx context.Context
-			ctx, m.searchCancel = context.WithCancel(context.Background())
-			m.searchCtx = ctx
-			// Delay slightly? No, immediate is fine with cancellation.
-			cmd = tea.Batch(cmd, performSearch(ctx, query))
-			m.status = "Searching..."
+			cmd = tea.Batch(cmd, m.search(query))
 		}
 	}
 
 	switch msg := msg.(type) {
 	case searchResultMsg:
 		m.packages = msg.packages
+		if m.upgrades != nil {
+			markUpgrades(m.packages, m.upgrades)
+		}
 		m.status = msg.status
-		m.filtered = m.packages
 		m.cursor = 0
-		if len(m.filtered) == 0 {
-			m.cursor = -1
-		}
+		m.refilter()
 	case searchErrorMsg:
 		m.status = "Search failed: " + msg.Error()
 	}
 
-	// Render the list content
+	m.header = ""
+	if m.help {
+		m.viewport.SetContent(strings.Join(helpLines(), "\n"))
+		return m, cmd
+	}
+	if m.picker != nil {
+		m.renderPicker()
+		return m, cmd
+	}
+	if m.deps != nil {
+		m.renderDeps()
+		return m, cmd
+	}
+	if m.columnPicker != nil {
+		m.renderColumns()
+		return m, cmd
+	}
+	if m.impact != nil {
+		m.viewport.SetContent(strings.Join(m.impact.lines(), "\n"))
+		m.viewport.GotoTop()
+		return m, cmd
+	}
+	if m.tab == reposTab {
+		m.renderRepos()
+		return m, cmd
+	}
+	if m.tab == cleanupTab {
+		m.renderCleanup()
+		return m, cmd
+	}
+	if m.tab == usageTab {
+		m.viewport.SetContent(strings.Join(usageChart(usageByManager(m.inventory), m.viewport.Width), "\n"))
+		return m, cmd
+	}
+
+	m.renderList()
+	return m, cmd
+}
+
+// search runs the query typed in the search box. Its facets filter the
+// listed packages, which are the results of searching for its words with the
+// package managers, or without words the installed packages.
+func (m *model) search(query string) tea.Cmd {
+	filter, err := parseFilter(query)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+	m.filter = filter
+	var cmds []tea.Cmd
+	if filter.needsUpgrades() && m.upgrades == nil && !m.checking {
+		m.checking = true
+		cmds = append(cmds, loadUpgrades(m.runner, m.managers))
+	}
+
+	words := strings.Join(filter.words, " ")
+	if words != m.searched {
+		m.searched = words
+		if m.searchCancel != nil {
+			m.searchCancel()
+		}
+		if words == "" {
+			m.packages = m.inventory
+		} else {
+			var ctx context.Context
+			ctx, m.searchCancel = context.WithCancel(context.Background())
+			m.searchCtx = ctx
+			cmds = append(cmds, performSearch(ctx, m.runner, m.packageKit, words))
+		}
+	}
+	m.refilter()
+	m.status = m.filterStatus()
+	if words != "" {
+		m.status = "Searching..."
+	}
+	return tea.Batch(cmds...)
+}
+
+// refilter runs the listed packages through the facets of the query, then
+// sorts them.
+func (m *model) refilter() {
+	m.filtered = m.layout.sort(m.filter.apply(m.packages))
+	m.cursor = min(max(m.cursor, 0), len(m.filtered)-1)
+	m.rows = nil
+}
+
+func (m model) filterStatus() string {
+	switch {
+	case m.checking:
+		return "Checking for upgrades..."
+	case len(m.filter.facets) == 0:
+		return "Ready"
+	}
+	return fmt.Sprintf("%d of %d packages match", len(m.filtered), len(m.packages))
+}
+
+// updatePicker handles the keys of the version picker: Enter installs the
+// selected version, Esc closes it.
+func (m *model) updatePicker(msg tea.KeyMsg) tea.Cmd {
+	p := m.picker
+	switch {
+	case key.Matches(msg, keys.Close):
+		m.picker = nil
+		m.status = "Ready"
+	case key.Matches(msg, keys.InstallVersion):
+		m.picker = nil
+		return versionJob(m.runner, p.pkg, p.versions[p.cursor])
+	}
+	return nil
+}
+
+// updateDeps handles the keys of the dependency panel.
+func (m *model) updateDeps(msg tea.KeyMsg) tea.Cmd {
+	t := m.deps
+	rows := t.rows()
+	t.cursor = min(t.cursor, len(rows)-1)
+	row := rows[t.cursor]
+	var cmd tea.Cmd
+	switch {
+	case key.Matches(msg, keys.Close):
+		m.deps = nil
+		m.status = "Ready"
+		return nil
+	case key.Matches(msg, keys.Expand):
+		cmd = t.expand(m.runner, row.node)
+	case key.Matches(msg, keys.Collapse):
+		if row.node.Expanded && len(row.node.Children) > 0 {
+			row.node.Expanded = false
+		} else if row.parent != nil {
+			// Go up to the parent, which is listed before
+			for i := t.cursor - 1; i >= 0; i-- {
+				if rows[i].node == row.parent {
+					t.cursor = i
+					break
+				}
+			}
+		}
+	case key.Matches(msg, keys.ReverseDeps):
+		t.reverse = !t.reverse
+		t.cursor = 0
+		if !t.root().Loaded {
+			cmd = t.expand(m.runner, t.root())
+		}
+	}
+	if status := t.status(); status != "" {
+		m.status = status
+	}
+	return cmd
+}
+
+// renderDeps fills the viewport with the dependency tree.
+func (m *model) renderDeps() {
+	t := m.deps
 	var sb strings.Builder
+	rows := t.rows()
+	for i, row := range rows {
+		line := truncate(row.label(), max(m.viewport.Width, 10))
+		sb.WriteString(m.row(line, i == t.cursor) + "\n")
+	}
+	m.viewport.SetContent(sb.String())
 
-	// Calculate column widths based on viewport width
-	totalWidth := max(m.viewport.Width, 40) // Fallback
+	if t.cursor < m.viewport.YOffset {
+		m.viewport.SetYOffset(t.cursor)
+	} else if t.cursor >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(t.cursor - m.viewport.Height + 1)
+	}
+}
 
-	colName := max(int(float64(totalWidth)*0.35), 10)
+// renderPicker fills the viewport with the versions of the picker.
+func (m *model) renderPicker() {
+	p := m.picker
+	totalWidth := max(m.viewport.Width, 40)
+	colVer := max(int(float64(totalWidth)*0.35), 10)
+
+	var sb strings.Builder
+	for i, v := range p.versions {
+		detail := v.Detail
+		if p.pkg.IsInstalled && v.Version == p.pkg.Version {
+			detail += " (installed)"
+		}
+		line := padRight(truncate(v.Version, colVer), colVer) + " " + truncate(detail, max(totalWidth-colVer-1, 10))
+		sb.WriteString(m.row(line, i == p.cursor) + "\n")
+	}
+	m.viewport.SetContent(sb.String())
+
+	if p.cursor < m.viewport.YOffset {
+		m.viewport.SetYOffset(p.cursor)
+	} else if p.cursor >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(p.cursor - m.viewport.Height + 1)
+	}
+}
+
+// switchTab shows another tab. The text input searches packages in the
+// packages tab, and holds the repository to add in the repositories tab.
+func (m *model) switchTab(tab int) tea.Cmd {
+	if m.tab == packagesTab && tab != packagesTab {
+		m.query = m.textInput.Value()
+		m.textInput.SetValue("")
+	}
+	m.tab = tab
+	switch tab {
+	case reposTab:
+		m.textInput.Placeholder = "Repository to add (e.g. ppa:user/name)..."
+		if !m.reposLoaded {
+			m.status = "Listing repositories..."
+			return loadRepositories(m.runner, m.managers)
+		}
+	case cleanupTab:
+		m.textInput.Placeholder = ""
+		m.status = "Looking for orphaned packages and caches..."
+		return loadCleanup(m.runner, m.managers)
+	case usageTab:
+		m.textInput.Placeholder = ""
+		m.status = usageSummary(usageByManager(m.inventory))
+	default:
+		m.textInput.SetValue(m.query)
+		m.textInput.Placeholder = searchPlaceholder
+	}
+	return nil
+}
+
+func (m *model) toggleDryRun() {
+	dryRun = !dryRun
+	if dryRun {
+		m.status = "Dry-run on: commands will be shown, not run"
+	} else {
+		m.status = "Dry-run off"
+	}
+}
+
+// updateRepos handles the keys of the repositories tab. Enter enables or
+// disables the selected repository and Ctrl+X removes it, once confirmed;
+// Ctrl+A adds the repository typed in the input to the manager of the
+// selected one.
+func (m *model) updateRepos(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, keys.ReposBack):
+		return m.switchTab(packagesTab), true
+	case key.Matches(msg, keys.DryRun):
+		m.toggleDryRun()
+		return nil, true
+	}
+
+	repo, ok := m.selectedRepo()
+	switch {
+	case key.Matches(msg, keys.ToggleRepo):
+		if spec := strings.TrimSpace(m.textInput.Value()); spec != "" && m.textInput.Focused() {
+			m.status = fmt.Sprintf("Press %s to add %s", keys.AddRepo.Help().Key, spec)
+			return nil, true
+		}
+		if !ok {
+			return nil, true
+		}
+		cmds := repo_commands[managerKey(repo.Manager)]
+		action, verb, template := "disable", "Disable", cmds.Disable
+		if !repo.Enabled {
+			action, verb, template = "enable", "Enable", cmds.Enable
+		}
+		job := repoJob(m.runner, action, repo.Manager, repo.Name)
+		if template == "" {
+			return job, true // Reports that it's not supported
+		}
+		m.status = fmt.Sprintf("%s the %s repository %s? Press Enter to %s it, any other key to cancel", verb, repo.Manager, repo.Name, action)
+		m.confirm = job
+		return nil, true
+	case key.Matches(msg, keys.RemoveRepo):
+		if !ok {
+			return nil, true
+		}
+		job := repoJob(m.runner, "remove", repo.Manager, repo.Name)
+		if repo_commands[managerKey(repo.Manager)].Remove == "" {
+			return job, true // Reports that it's not supported
+		}
+		m.status = fmt.Sprintf("Remove the %s repository %s? Press Enter to remove it, any other key to cancel", repo.Manager, repo.Name)
+		m.confirm = job
+		return nil, true
+	case key.Matches(msg, keys.AddRepo):
+		spec := strings.TrimSpace(m.textInput.Value())
+		manager := repo.Manager
+		if !ok {
+			manager = m.repoManager()
+		}
+		if spec == "" || manager == "" {
+			m.status = "Type the repository to add, and select a repository of the same manager"
+			return nil, true
+		}
+		m.textInput.SetValue("")
+		return repoJob(m.runner, "add", manager, spec), true
+	}
+	return nil, false
+}
+
+// updateCleanup handles the keys of the clean up tab. Enter removes the
+// selected orphans or empties the selected cache, once confirmed.
+func (m *model) updateCleanup(msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, keys.CleanupBack):
+		return m.switchTab(packagesTab), true
+	case key.Matches(msg, keys.DryRun):
+		m.toggleDryRun()
+	case key.Matches(msg, keys.Clean):
+		if m.cleanupAt >= len(m.cleanup) {
+			break
+		}
+		item := m.cleanup[m.cleanupAt]
+		if item.empty() {
+			m.status = "Nothing to clean up there"
+			break
+		}
+		m.status = fmt.Sprintf("%s: %s (%s). Press Enter to remove them, any other key to cancel", item.Manager, item.describe(), item.size())
+		m.confirm = cleanupJob(m.runner, item)
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// renderCleanup fills the viewport with the orphans and caches per manager.
+func (m *model) renderCleanup() {
+	totalWidth := max(m.viewport.Width, 40)
 	colMgr := max(int(float64(totalWidth)*0.15), 6)
-	colStatus := max(int(float64(totalWidth)*0.15), 10)
-	colVer := max(totalWidth-colName-colMgr-colStatus-3, 10)
+	colKind := 8
+	colSize := 10
+	colWhat := max(totalWidth-colMgr-colKind-colSize-3, 10)
 
-	formatStr := fmt.Sprintf("%%-%ds %%-%ds %%-%ds %%s", colName, colMgr, colVer)
+	var sb strings.Builder
+	for i, item := range m.cleanup {
+		line := strings.Join([]string{padRight(truncate(item.Manager, colMgr), colMgr), padRight(item.Kind, colKind), padLeft(item.size(), colSize), truncate(item.describe(), colWhat)}, " ")
+		sb.WriteString(m.row(line, i == m.cleanupAt) + "\n")
+	}
+	m.viewport.SetContent(sb.String())
+
+	if m.cleanupAt < m.viewport.YOffset {
+		m.viewport.SetYOffset(m.cleanupAt)
+	} else if m.cleanupAt >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(m.cleanupAt - m.viewport.Height + 1)
+	}
+}
 
-	for i, pkg := range m.filtered {
-		installed := "installed ✓"
-		if !pkg.IsInstalled {
-			installed = "install ↓"
+// updateUsage handles the keys of the disk usage tab, which only shows the
+// size of the installed packages per manager.
+func (m *model) updateUsage(msg tea.KeyMsg) (tea.Cmd, bool) {
+	if key.Matches(msg, keys.UsageBack) {
+		return m.switchTab(packagesTab), true
+	}
+	return nil, true
+}
+
+// updateColumns handles the keys of the column picker: Enter shows or hides
+// the selected column, Shift+Up/Down moves it.
+func (m *model) updateColumns(msg tea.KeyMsg) {
+	p := m.columnPicker
+	ids := p.ids(m.layout)
+	switch {
+	case key.Matches(msg, keys.Close, keys.Columns):
+		m.columnPicker = nil
+		m.status = "Ready"
+		return
+	case key.Matches(msg, keys.ToggleColumn):
+		m.layout.toggle(ids[p.cursor])
+	case key.Matches(msg, keys.MoveColumnUp, keys.MoveColumnDown):
+		delta := -1
+		if key.Matches(msg, keys.MoveColumnDown) {
+			delta = 1
+		}
+		m.layout.move(ids[p.cursor], delta)
+	default:
+		return
+	}
+	// Keep the cursor on the same column, which may have moved
+	p.cursor = slices.Index(p.ids(m.layout), ids[p.cursor])
+	m.rows = nil
+	m.saveLayout()
+}
+
+// renderColumns fills the viewport with the columns to choose from.
+func (m *model) renderColumns() {
+	var sb strings.Builder
+	for i, id := range m.columnPicker.ids(m.layout) {
+		c, _ := findColumn(id)
+		mark := "[ ]"
+		if slices.Contains(m.layout.Columns, id) {
+			mark = "[x]"
 		}
+		line := mark + " " + c.Title
+		sb.WriteString(m.row(line, i == m.columnPicker.cursor) + "\n")
+	}
+	m.viewport.SetContent(sb.String())
+	m.viewport.GotoTop()
+}
 
-		name := truncate(pkg.Name, colName)
-		manager := truncate(pkg.Manager, colMgr)
-		version := truncate(pkg.Version, colVer)
+// saveLayout keeps the columns and sort order for the next runs.
+func (m *model) saveLayout() {
+	if err := m.layout.save(); err != nil {
+		m.status = "Failed to save the list layout: " + err.Error()
+	}
+}
 
-		line := fmt.Sprintf(formatStr, name, manager, version, installed)
-		if i == m.cursor {
-			styled := selectedItemStyle.Width(m.viewport.Width).Render(line)
-			sb.WriteString(styled + "\n")
-		} else {
-			sb.WriteString(line + "\n")
+// repoManager is the first detected manager with repositories, for adding
+// one when none is listed.
+func (m model) repoManager() string {
+	for _, p := range m.managers {
+		if _, ok := repo_commands[managerKey(p.Name)]; ok {
+			return managerKey(p.Name)
 		}
 	}
+	return ""
+}
+
+func (m model) selectedRepo() (repository, bool) {
+	if m.repoCursor < 0 || m.repoCursor >= len(m.repos) {
+		return repository{}, false
+	}
+	return m.repos[m.repoCursor], true
+}
+
+// renderRepos fills the viewport with the repositories tab.
+func (m *model) renderRepos() {
+	totalWidth := max(m.viewport.Width, 40)
+	colName := max(int(float64(totalWidth)*0.35), 10)
+	colMgr := max(int(float64(totalWidth)*0.15), 6)
+	colStatus := max(int(float64(totalWidth)*0.10), 8)
+	colURL := max(totalWidth-colName-colMgr-colStatus-3, 10)
+
+	var sb strings.Builder
+	for i, repo := range m.repos {
+		enabled := "enabled"
+		if !repo.Enabled {
+			enabled = "disabled"
+		}
+		line := strings.Join([]string{padRight(truncate(repo.Name, colName), colName), padRight(truncate(repo.Manager, colMgr), colMgr), padRight(truncate(repo.URL, colURL), colURL), enabled}, " ")
+		sb.WriteString(m.row(line, i == m.repoCursor) + "\n")
+	}
 	m.viewport.SetContent(sb.String())
 
-	// Vertical scroll logic
-	if m.cursor >= 0 {
-		if m.cursor < m.viewport.YOffset {
-			m.viewport.SetYOffset(m.cursor)
-		} else if m.cursor >= m.viewport.YOffset+m.viewport.Height {
-			m.viewport.SetYOffset(m.cursor - m.viewport.Height + 1)
+	if m.repoCursor < m.viewport.YOffset {
+		m.viewport.SetYOffset(m.repoCursor)
+	} else if m.repoCursor >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(m.repoCursor - m.viewport.Height + 1)
+	}
+}
+
+// selected returns the package under the cursor.
+func (m model) selected() (Package, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.filtered) {
+		return Package{}, false
+	}
+	return m.filtered[m.cursor], true
+}
+
+// setInstalled updates the installed state of a package after a job, so the
+// list doesn't have to be scanned again.
+func (m *model) setInstalled(pkg Package, installed bool) {
+	m.rows = nil
+	for _, list := range [][]Package{m.packages, m.filtered} {
+		for i := range list {
+			if list[i].Name == pkg.Name && list[i].Manager == pkg.Manager {
+				list[i].IsInstalled = installed
+			}
 		}
 	}
 
-	return m, cmd
+	idx := -1
+	for i, p := range m.inventory {
+		if p.Name == pkg.Name && p.Manager == pkg.Manager {
+			idx = i
+			break
+		}
+	}
+	switch {
+	case installed && idx < 0:
+		pkg.IsInstalled = true
+		m.inventory = append(m.inventory, pkg)
+	case !installed && idx >= 0:
+		m.inventory = append(m.inventory[:idx:idx], m.inventory[idx+1:]...)
+	}
+}
+
+// setHeld updates the held state of a package after a hold job.
+func (m *model) setHeld(pkg Package, held bool) {
+	m.rows = nil
+	for _, list := range [][]Package{m.inventory, m.packages, m.filtered} {
+		for i := range list {
+			if list[i].Name == pkg.Name && list[i].Manager == pkg.Manager {
+				list[i].Held = held
+				// Managers without a Hold template are held in holds.json
+				list[i].OwnHold = held && pm_commands[managerKey(pkg.Manager)].Hold == ""
+			}
+		}
+	}
 }
 
-func performSearch(ctx context.Context, query string) tea.Cmd {
+// setUpgraded clears the upgrade of a package once it's been upgraded.
+func (m *model) setUpgraded(pkg Package) {
+	m.rows = nil
+	for _, list := range [][]Package{m.inventory, m.packages, m.filtered} {
+		for i := range list {
+			if list[i].Name == pkg.Name && list[i].Manager == pkg.Manager {
+				list[i].Upgrade = ""
+			}
+		}
+	}
+}
+
+// findElsewhere describes the selected package's names in other managers.
+func (m model) findElsewhere() string {
+	pkg, ok := m.selected()
+	if !ok {
+		return "No package selected"
+	}
+	if m.pkgMap == nil {
+		return "Package mappings are not available"
+	}
+	alts := m.pkgMap.alternatives(pkg.Name, pkg.Manager)
+	if len(alts) == 0 {
+		return fmt.Sprintf("No known names for %s in other package managers", pkg.Name)
+	}
+	return fmt.Sprintf("%s elsewhere: %s", pkg.Name, formatAlternatives(alts))
+}
+
+func performSearch(ctx context.Context, r Runner, pk *packageKitClient, query string) tea.Cmd {
 	return func() tea.Msg {
 		if strings.TrimSpace(query) == "" {
 			return searchResultMsg{packages: []Package{}, status: "Ready"}
@@ -205,22 +955,24 @@ func performSearch(ctx context.Context, query string) tea.Cmd {
 
 		var pkgs []Package
 
-		// APT Search
-		cmdApt := exec.CommandContext(ctx, "apt", "search", "--names-only", strings.ToLower(query))
-		cmdApt.Env = append(cmdApt.Env, "TERM=dumb")
-		outApt, err := cmdApt.Output()
+		// APT Search, or the PackageKit backend's
+		search := searchApt
+		if pk != nil {
+			search = func(ctx context.Context, _ Runner, query string) ([]Package, error) {
+				return pk.search(ctx, query)
+			}
+		}
+		aptPkgs, err := search(ctx, r, strings.ToLower(query))
 		if err == nil {
-			pkgs = append(pkgs, parseAptOutput(outApt)...)
+			pkgs = append(pkgs, aptPkgs...)
 		} else if ctx.Err() != nil {
 			return nil // Cancelled
 		}
 
 		// Snap Search
-		cmdSnap := exec.CommandContext(ctx, "snap", "search", strings.ToLower(query))
-		cmdSnap.Env = append(cmdSnap.Env, "TERM=dumb")
-		outSnap, err := cmdSnap.Output()
+		snapPkgs, err := newSnapdClient(r).find(ctx, strings.ToLower(query))
 		if err == nil {
-			pkgs = append(pkgs, parseSnapOutput(outSnap)...)
+			pkgs = append(pkgs, snapPkgs...)
 		} else if ctx.Err() != nil {
 			return nil // Cancelled
 		}
@@ -232,72 +984,51 @@ func performSearch(ctx context.Context, query string) tea.Cmd {
 	}
 }
 
-func parseAptOutput(output []byte) []Package {
-	var pkgs []Package
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	var currentPkg *Package
+func (m model) View() string {
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || line == "Sorting... Done" || line == "Full Text Search... Done" {
-			continue
+	hints := hintsOf(keys.Navigate, keys.Install, keys.Remove, keys.Versions, keys.Dependencies, keys.Hold, keys.Repos, keys.Cleanup, keys.Usage, keys.Focus, keys.Help, keys.Escape)
+	switch {
+	case m.confirm != nil:
+		hints = hintsOf(keys.Confirm) + " • Any other key: Cancel"
+	case m.help:
+		hints = "Keys: " + hintsOf(keys.Navigate, keys.Close)
+	case m.picker != nil:
+		hints = "Versions of " + m.picker.pkg.Name + ": " + hintsOf(keys.Navigate, keys.InstallVersion, keys.Close)
+	case m.deps != nil:
+		reverse := keys.ReverseDeps
+		if m.deps.reverse {
+			reverse.SetHelp(reverse.Help().Key, "Its dependencies")
+		} else {
+			reverse.SetHelp(reverse.Help().Key, "What depends on it")
 		}
-		if strings.Contains(line, "/") {
-			if currentPkg != nil {
-				pkgs = append(pkgs, *currentPkg)
-			}
-			parts := strings.Fields(line)
-			if len(parts) < 2 {
-				currentPkg = nil
-				continue
+		hints = hintsOf(keys.Navigate, keys.Expand, keys.Collapse, reverse, keys.Close)
+	case m.columnPicker != nil:
+		hints = "Columns: " + hintsOf(keys.Navigate, keys.ToggleColumn, keys.MoveColumnUp, keys.MoveColumnDown, keys.Close)
+	case m.tab == usageTab:
+		hints = "Installed size per package manager • " + hintsOf(keys.UsageBack, keys.Help, keys.Escape)
+	case m.tab == cleanupTab:
+		hints = hintsOf(keys.Navigate, keys.Clean, keys.CleanupBack, keys.DryRun, keys.Help, keys.Escape)
+	case m.tab == reposTab:
+		// Only the actions the manager of the selected repository has
+		bindings := []key.Binding{keys.Navigate}
+		if repo, ok := m.selectedRepo(); ok {
+			cmds := repo_commands[managerKey(repo.Manager)]
+			if cmds.Enable != "" {
+				bindings = append(bindings, keys.ToggleRepo)
 			}
-			rawName := parts[0]
-			name := strings.Split(rawName, "/")[0]
-			version := parts[1]
-			isInstalled := strings.Contains(line, "[installed")
-			currentPkg = &Package{
-				Name:        name,
-				Version:     version,
-				Manager:     "apt/dpkg",
-				IsInstalled: isInstalled,
+			if cmds.Remove != "" {
+				bindings = append(bindings, keys.RemoveRepo)
 			}
-			pkgs = append(pkgs, *currentPkg)
 		}
+		hints = hintsOf(append(bindings, keys.AddRepo, keys.ReposBack, keys.DryRun, keys.Focus, keys.Help, keys.Escape)...)
 	}
-	if currentPkg != nil {
-		pkgs = append(pkgs, *currentPkg)
-	}
-	return pkgs
-}
-
-func parseSnapOutput(output []byte) []Package {
-	var pkgs []Package
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		parts := strings.Fields(line)
-		if len(parts) < 2 || parts[0] == "Name" { // Skip header too if present
-			continue
-		}
-		pkgs = append(pkgs, Package{
-			Name:        parts[0],
-			Version:     parts[1],
-			Manager:     "snap",
-			IsInstalled: false, // todo check
-		})
+	if dryRun {
+		hints = "[dry-run] " + hints
 	}
-	return pkgs
-}
-
-func (m model) View() string {
-	if m.width == 0 || m.height == 0 {
-		return "Initializing..."
-	}
-
-	commandBar := commandBarStyle.Render("Arrows: Navigate • Esc: Quit")
+	commandBar := commandBarStyle.Render(truncate(hints, m.width))
 
 	statusBar := statusBarStyle.Width(m.width)
 
@@ -308,23 +1039,57 @@ func (m model) View() string {
 	inputStyle := inputBoxStyle.Width(availableWidth - 2)
 
 	// List box: Border takes 2. Content width matches available minus border.
-	listStyle := listBoxStyle.Width(availableWidth - 2).Height(m.viewport.Height)
+	listStyle := listBoxStyle.Width(availableWidth - 2).Height(m.viewport.Height + 1)
+
+	// The border of the one with the focus stands out
+	if !m.typing() {
+		inputStyle = inputStyle.BorderForeground(inactiveBorderColor)
+		listStyle = listStyle.BorderForeground(activeBorderColor)
+	}
+	list := m.viewport.View()
+	if m.header != "" {
+		list = m.header + "\n" + list
+	}
 
 	return appStyle.Render(fmt.Sprintf(
 		"%s\n\n%s\n%s\n%s",
 		inputStyle.Render(m.textInput.View()),
-		listStyle.Render(m.viewport.View()),
+		listStyle.Render(list),
 		commandBar,
 		statusBar.Render(m.status),
 	)) + "\n"
 }
 
+// truncate shortens s to maxLen terminal cells. Wide characters, e.g. CJK or
+// emoji, take two, and are left out whole when they don't fit.
 func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	if ansi.StringWidth(s) <= maxLen {
 		return s
 	}
 	if maxLen < 3 {
-		return s[:maxLen]
+		return ansi.Truncate(s, maxLen, "")
+	}
+	return ansi.Truncate(s, maxLen, "…")
+}
+
+// padRight and padLeft pad s with spaces to width cells, unlike fmt's %-*s
+// and %*s, which count runes.
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-ansi.StringWidth(s), 0))
+}
+
+func padLeft(s string, width int) string {
+	return strings.Repeat(" ", max(width-ansi.StringWidth(s), 0)) + s
+}
+
+// row renders a line of the viewport, highlighted if selected. Lines are cut
+// to the viewport rather than wrapped, so a row stays a row.
+func (m model) row(line string, selected bool) string {
+	if m.viewport.Width > 0 {
+		line = truncate(line, m.viewport.Width)
+	}
+	if selected {
+		return selectedItemStyle.Width(m.viewport.Width).Render(line)
 	}
-	return s[:maxLen-1] + "…"
+	return line
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fixtureModel is the TUI over the packages of a fixture dir, sized as a
+// terminal of 100x40.
+func fixtureModel(t *testing.T, dir string) model {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	r := fixtureRunner{dir: "testdata/fixtures/" + dir}
+	pms := detectPM(r)
+	pkgs, _ := scanPackages(r, pms)
+	m, _ := initialModel(r, nil, pms, pkgs, "").Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	return m.(model)
+}
+
+// update sends the messages to the model, one after the other, and returns
+// the command of the last one.
+func update(m model, msgs ...tea.Msg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+	for _, msg := range msgs {
+		var next tea.Model
+		next, cmd = m.Update(msg)
+		m = next.(model)
+	}
+	return m, cmd
+}
+
+func typed(s string) []tea.Msg {
+	var msgs []tea.Msg
+	for _, r := range s {
+		msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return msgs
+}
+
+// Removing a package previews what it affects and waits for a confirmation.
+func TestUpdateRemoveFlow(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	m := fixtureModel(t, "ubuntu")
+
+	m, _ = update(m, typed("mgr:apt held:no explicit:yes")...)
+	if len(m.filtered) != 1 || m.filtered[0].Name != "adduser" {
+		t.Fatalf("filtered = %+v, want adduser only", m.filtered)
+	}
+
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyCtrlX})
+	if cmd == nil {
+		t.Fatal("Ctrl+X returned no command")
+	}
+	m, _ = update(m, cmd())
+	if m.confirm == nil {
+		t.Fatal("the removal wasn't left to confirm")
+	}
+	if !strings.Contains(m.status, "ubuntu-minimal") {
+		t.Errorf("status = %q, want the dependent ubuntu-minimal", m.status)
+	}
+	if view := m.View(); !strings.Contains(view, "Any other key: Cancel") {
+		t.Errorf("view doesn't ask for a confirmation:\n%s", view)
+	}
+
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if m.confirm != nil || cmd != nil || m.status != "Cancelled" {
+		t.Errorf("after cancelling: confirm set %v, command %v, status %q", m.confirm != nil, cmd != nil, m.status)
+	}
+
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyCtrlX})
+	m, _ = update(m, cmd())
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.confirm != nil || cmd == nil {
+		t.Fatal("Enter didn't confirm the removal")
+	}
+	m, _ = update(m, cmd())
+	if want := "[dry-run] sudo apt remove adduser"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+}
+
+// Installing or upgrading shows the command and waits for a confirmation,
+// even when Enter is pressed in the search box.
+func TestUpdateInstallConfirm(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	m := fixtureModel(t, "ubuntu")
+	m, _ = update(m, typed("mgr:apt held:no explicit:yes")...)
+
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || m.confirm == nil {
+		t.Fatal("Enter didn't ask for a confirmation")
+	}
+	if want := "Upgrade adduser with sudo apt install --only-upgrade adduser? Press Enter to run it, any other key to cancel"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("Enter didn't confirm the upgrade")
+	}
+	m, _ = update(m, cmd())
+	if want := "[dry-run] sudo apt install --only-upgrade adduser"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+
+	// A held package isn't upgraded at all
+	m.textInput.SetValue("")
+	m, _ = update(m, typed("held:yes mgr:apt")...)
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || m.confirm != nil || !strings.Contains(m.status, "is held") {
+		t.Errorf("a held package: command %v, confirm set %v, status %q", cmd != nil, m.confirm != nil, m.status)
+	}
+}
+
+// The list follows the cursor, which stops at either end.
+func TestUpdateNavigation(t *testing.T) {
+	m := fixtureModel(t, "ubuntu")
+	m, _ = update(m, tea.KeyMsg{Type: tea.KeyTab})
+	if m.textInput.Focused() {
+		t.Fatal("Tab didn't focus the list")
+	}
+
+	last := len(m.filtered) - 1
+	tests := []struct {
+		key  tea.KeyMsg
+		want int
+	}{
+		{tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}}, 1},
+		{tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'G'}}, last},
+		{tea.KeyMsg{Type: tea.KeyDown}, last},
+		{tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'k'}}, last - 1},
+		{tea.KeyMsg{Type: tea.KeyHome}, 0},
+		{tea.KeyMsg{Type: tea.KeyUp}, 0},
+	}
+	for _, tt := range tests {
+		m, _ = update(m, tt.key)
+		if m.cursor != tt.want {
+			t.Fatalf("after %s: cursor = %d, want %d", tt.key, m.cursor, tt.want)
+		}
+		if name := m.filtered[m.cursor].Name; !strings.Contains(m.View(), name) {
+			t.Fatalf("after %s: %s isn't shown", tt.key, name)
+		}
+	}
+}
+
+// openRepos opens the repositories tab once they're listed.
+func openRepos(t *testing.T, m model) model {
+	t.Helper()
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyCtrlT})
+	if cmd == nil {
+		t.Fatal("Ctrl+T didn't list the repositories")
+	}
+	m, _ = update(m, cmd())
+	if len(m.repos) == 0 {
+		t.Fatalf("no repositories: %s", m.status)
+	}
+	return m
+}
+
+// Removing a repository waits for a confirmation, and only the actions the
+// manager of the selected repository has are offered.
+func TestUpdateRepos(t *testing.T) {
+	m := openRepos(t, fixtureModel(t, "ubuntu"))
+	if m.repos[0].Manager != "apt" {
+		t.Fatalf("first repository is %+v, want an apt one", m.repos[0])
+	}
+	view := m.View()
+	if strings.Contains(view, "Enable/Disable") || !strings.Contains(view, "Ctrl+X: Remove") {
+		t.Errorf("apt repositories can be removed but not toggled, the hints are:\n%s", view)
+	}
+
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyCtrlX})
+	if cmd != nil || m.confirm == nil || !strings.Contains(m.status, "Remove the apt repository") {
+		t.Fatalf("Ctrl+X didn't ask for a confirmation: command %v, status %q", cmd != nil, m.status)
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if cmd != nil || m.confirm != nil {
+		t.Errorf("the removal wasn't cancelled")
+	}
+}
+
+// dnf5 enables and disables repositories with `config-manager setopt`, once
+// confirmed, and adds them with `addrepo`.
+func TestUpdateReposDnf5(t *testing.T) {
+	dryRun = true
+	t.Cleanup(func() { dryRun = false })
+	m := openRepos(t, fixtureModel(t, "fedora"))
+	if repo := m.repos[0]; repo.Manager != "dnf" || !repo.Enabled {
+		t.Fatalf("first repository is %+v, want an enabled dnf one", repo)
+	}
+	if view := m.View(); !strings.Contains(view, "Enable/Disable") || strings.Contains(view, "Ctrl+X: Remove") {
+		t.Errorf("dnf repositories can be toggled but not removed, the hints are:\n%s", view)
+	}
+
+	m, cmd := update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || m.confirm == nil {
+		t.Fatal("Enter didn't ask for a confirmation")
+	}
+	if want := "Disable the dnf repository fedora? Press Enter to disable it, any other key to cancel"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("Enter didn't confirm disabling the repository")
+	}
+	m, _ = update(m, cmd())
+	if want := "[dry-run] sudo dnf config-manager setopt fedora.enabled=0"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+
+	// Enter while a repository is typed doesn't toggle the selected one
+	m, _ = update(m, typed("https://example.com/tools.repo")...)
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || m.confirm != nil || m.status != "Press Ctrl+A to add https://example.com/tools.repo" {
+		t.Errorf("Enter in the input: command %v, confirm set %v, status %q", cmd != nil, m.confirm != nil, m.status)
+	}
+	m, cmd = update(m, tea.KeyMsg{Type: tea.KeyCtrlA})
+	if cmd == nil {
+		t.Fatal("Ctrl+A didn't add the repository")
+	}
+	m, _ = update(m, cmd())
+	if want := "[dry-run] sudo dnf config-manager addrepo --from-repofile https://example.com/tools.repo"; m.status != want {
+		t.Errorf("status = %q, want %q", m.status, want)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// upgradeLister lists the packages of a manager that an upgrade would
+// change, by name, with the version it would install. They are listed from
+// what the manager already knows, without refreshing its index.
+type upgradeLister struct {
+	managers []string // detected manager names that use this lister
+	keys     []string // manager keys of the upgradable packages
+	argv     []string
+	parse    func([]byte) map[string]string
+	list     func(context.Context, Runner) (map[string]string, error)
+}
+
+var upgradeListers = []upgradeLister{
+	{managers: []string{"apt", "dpkg", "dpkg-query"}, keys: []string{"apt"}, argv: []string{"apt-get", "-s", "upgrade"}, parse: parseAptUpgradeSimulation},
+	{managers: []string{"pacman"}, keys: []string{"pacman"}, argv: []string{"pacman", "-Qu"}, parse: parsePacmanUpgrades},
+	// -C uses the cached metadata, even if it expired
+	{managers: []string{"dnf"}, keys: []string{"dnf"}, argv: []string{"dnf", "-C", "repoquery", "--upgrades", "--queryformat", `%{name} %{evr}\n`}, parse: parseNameVersions},
+	{managers: []string{"brew"}, keys: []string{"brew"}, argv: []string{"brew", "outdated", "--json=v2"}, parse: parseBrewOutdatedJSON},
+	{managers: []string{"flatpak", "flatpak-user"}, keys: []string{"flatpak", "flatpak-user"}, argv: []string{"flatpak", "remote-ls", "--updates", "--columns=application,version,branch"}, parse: parseFlatpakUpdates},
+	{managers: []string{"snap"}, keys: []string{"snap"}, list: listSnapRefreshes},
+}
+
+// scanUpgrades returns the upgradable packages of the detected managers, by
+// manager key, then name. Managers whose upgrades can't be listed are left
+// out.
+func scanUpgrades(ctx context.Context, r Runner, pms []packageManager) map[string]map[string]string {
+	upgrades := make(map[string]map[string]string)
+	listed := make(map[int]bool, len(upgradeListers))
+	for _, p := range pms {
+		for i, l := range upgradeListers {
+			if listed[i] || !slices.Contains(l.managers, p.Name) {
+				continue
+			}
+			listed[i] = true
+			var found map[string]string
+			if l.list != nil {
+				found, _ = l.list(ctx, r)
+			} else if out, err := r.Output(ctx, l.argv[0], l.argv[1:]...); err == nil {
+				found = l.parse(out)
+			}
+			for _, key := range l.keys {
+				upgrades[key] = found
+			}
+		}
+	}
+	return upgrades
+}
+
+// markUpgrades sets Upgrade on the packages an upgrade would change.
+func markUpgrades(pkgs []Package, upgrades map[string]map[string]string) {
+	for i, p := range pkgs {
+		if !p.IsInstalled {
+			continue
+		}
+		found := upgrades[managerKey(p.Manager)]
+		version, ok := found[p.Name]
+		if !ok {
+			// dpkg qualifies some names with their arch, apt-get doesn't
+			name, _, _ := strings.Cut(p.Name, ":")
+			version = found[name]
+		}
+		pkgs[i].Upgrade = version
+	}
+}
+
+// parseAptUpgradeSimulation parses the "Inst name [version] (new-version
+// suite [arch])" lines of `apt-get -s upgrade`. New packages it would
+// install have no current version in brackets.
+func parseAptUpgradeSimulation(out []byte) map[string]string {
+	upgrades := make(map[string]string)
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "Inst" || !strings.HasPrefix(fields[2], "[") {
+			continue
+		}
+		upgrades[fields[1]] = strings.TrimPrefix(fields[3], "(")
+	}
+	return upgrades
+}
+
+// parsePacmanUpgrades parses `pacman -Qu`: "name version -> new-version",
+// followed by "[ignored]" for held packages, which are left out.
+func parsePacmanUpgrades(out []byte) map[string]string {
+	upgrades := make(map[string]string)
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[2] != "->" {
+			continue
+		}
+		upgrades[fields[0]] = fields[3]
+	}
+	return upgrades
+}
+
+// parseNameVersions parses "name version" per line, as printed by `dnf
+// repoquery --queryformat`, whose dnf4 version prints the "\n" as is.
+func parseNameVersions(out []byte) map[string]string {
+	upgrades := make(map[string]string)
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), `\n`))
+		if len(fields) == 2 {
+			upgrades[fields[0]] = fields[1]
+		}
+	}
+	return upgrades
+}
+
+// parseBrewOutdatedJSON parses `brew outdated --json=v2`, which lists the
+// outdated formulae and casks with their current version. Pinned formulae
+// are listed too, but not upgraded.
+func parseBrewOutdatedJSON(out []byte) map[string]string {
+	var outdated struct {
+		Formulae []struct {
+			Name           string `json:"name"`
+			CurrentVersion string `json:"current_version"`
+			Pinned         bool   `json:"pinned"`
+		} `json:"formulae"`
+		Casks []struct {
+			Name           string `json:"name"`
+			CurrentVersion string `json:"current_version"`
+		} `json:"casks"`
+	}
+	if err := json.Unmarshal(out, &outdated); err != nil {
+		return nil
+	}
+	upgrades := make(map[string]string)
+	for _, f := range outdated.Formulae {
+		if !f.Pinned {
+			upgrades[f.Name] = f.CurrentVersion
+		}
+	}
+	for _, c := range outdated.Casks {
+		upgrades[c.Name] = c.CurrentVersion
+	}
+	return upgrades
+}
+
+// parseFlatpakUpdates parses `flatpak remote-ls --updates` with the
+// application, version and branch columns.
+func parseFlatpakUpdates(out []byte) map[string]string {
+	upgrades := make(map[string]string)
+	for _, line := range outputLines(out) {
+		fields := tabFields(line)
+		if fields[0] == "" {
+			continue
+		}
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		// Like installed ones, some have no version, only a branch
+		version := fields[1]
+		if version == "" {
+			version = fields[2]
+		}
+		upgrades[fields[0]] = version
+	}
+	return upgrades
+}
+
+// listSnapRefreshes asks snapd which snaps have a newer revision in their
+// channel.
+func listSnapRefreshes(ctx context.Context, r Runner) (map[string]string, error) {
+	snaps, err := newSnapdClient(r).refreshable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upgrades := make(map[string]string, len(snaps))
+	for _, s := range snaps {
+		upgrades[s.Name] = s.Version
+	}
+	return upgrades, nil
+}
+
+// upgradesMsg carries the upgradable packages, checked the first time a
+// filter asks for them.
+type upgradesMsg struct {
+	upgrades map[string]map[string]string
+}
+
+func loadUpgrades(r Runner, pms []packageManager) tea.Cmd {
+	return func() tea.Msg {
+		return upgradesMsg{upgrades: scanUpgrades(context.Background(), r, pms)}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// duSizes measures the disk usage of paths with `du -sk`. du fails for the
+// paths it can't read all of, e.g. apt's partial downloads only root can
+// list, but still reports the rest; paths that don't exist are left out.
+func duSizes(ctx context.Context, r Runner, paths []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(paths))
+	if len(paths) == 0 {
+		return sizes, nil
+	}
+	out, err := r.Output(ctx, "du", append([]string{"-sk"}, paths...)...)
+	for _, line := range outputLines(out) {
+		kib, path, ok := strings.Cut(line, "\t")
+		n, convErr := strconv.ParseInt(kib, 10, 64)
+		if !ok || convErr != nil {
+			continue
+		}
+		sizes[path] = n * 1024
+	}
+	if len(sizes) == 0 && err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+// duSize adds up the disk usage of paths, and returns the paths that exist.
+func duSize(ctx context.Context, r Runner, paths []string) ([]string, int64, error) {
+	sizes, err := duSizes(ctx, r, paths)
+	if err != nil {
+		return nil, -1, err
+	}
+	var found []string
+	var size int64
+	for _, path := range paths {
+		if n, ok := sizes[path]; ok {
+			found = append(found, path)
+			size += n
+		}
+	}
+	return found, size, nil
+}
+
+// parseHumanSize parses sizes like "1.50 MiB" or "512.00 B", as printed by
+// pacman, and "12.3 MB" or "456 bytes", in powers of 1000, as printed by
+// flatpak with a no-break space before the unit.
+func parseHumanSize(s string) (int64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	for i, u := range []string{"B", "KiB", "MiB", "GiB", "TiB"} {
+		if fields[1] == u {
+			return int64(n * float64(int64(1)<<(10*i))), true
+		}
+	}
+	for i, u := range []string{"bytes", "kB", "MB", "GB", "TB"} {
+		if fields[1] == u || fields[1] == "byte" && i == 0 {
+			return int64(n * math.Pow(1000, float64(i))), true
+		}
+	}
+	return 0, false
+}
+
+// humanSize formats a number of bytes, e.g. "12.3 GiB".
+func humanSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, unit := float64(n)/1024, "KiB"
+	for _, u := range []string{"MiB", "GiB", "TiB"} {
+		if size < 1024 {
+			break
+		}
+		size, unit = size/1024, u
+	}
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
+
+// addSizes fills in the sizes of pkgs from the same packages listed by
+// another command. Packages listed once per arch add up.
+func addSizes(pkgs, sized []Package) {
+	sizes := make(map[string]int64, len(sized))
+	for _, p := range sized {
+		sizes[p.Name] += p.Size
+	}
+	for i := range pkgs {
+		if pkgs[i].Size == 0 {
+			pkgs[i].Size = sizes[pkgs[i].Name]
+		}
+	}
+}
+
+// packageSize is the size column of the package list, empty if unknown.
+func packageSize(p Package) string {
+	if p.Size <= 0 {
+		return ""
+	}
+	return humanSize(p.Size)
+}
+
+// managerUsage is the installed size of the packages of a manager.
+type managerUsage struct {
+	Manager  string
+	Size     int64
+	Packages int
+	Unknown  int // Packages whose size isn't known, e.g. all of brew's
+}
+
+// usageByManager adds up the size of the installed packages per manager,
+// the largest first.
+func usageByManager(pkgs []Package) []managerUsage {
+	var usage []managerUsage
+	index := make(map[string]int)
+	for _, p := range pkgs {
+		if !p.IsInstalled {
+			continue
+		}
+		i, ok := index[p.Manager]
+		if !ok {
+			i = len(usage)
+			index[p.Manager] = i
+			usage = append(usage, managerUsage{Manager: p.Manager})
+		}
+		usage[i].Packages++
+		if p.Size > 0 {
+			usage[i].Size += p.Size
+		} else {
+			usage[i].Unknown++
+		}
+	}
+	slices.SortStableFunc(usage, func(a, b managerUsage) int { return cmp.Compare(b.Size, a.Size) })
+	return usage
+}
+
+func (u managerUsage) size() string {
+	if u.Size == 0 && u.Unknown > 0 {
+		return "?"
+	}
+	return humanSize(u.Size)
+}
+
+func (u managerUsage) describe() string {
+	switch {
+	case u.Unknown == u.Packages:
+		return plural(u.Packages, "package") + ", size unknown"
+	case u.Unknown > 0:
+		return fmt.Sprintf("%s, %d of unknown size", plural(u.Packages, "package"), u.Unknown)
+	}
+	return plural(u.Packages, "package")
+}
+
+// usageSummary totals the usage, e.g. "Installed size: 15.2 GiB (flatpak:
+// 12.3 GiB, snap: 2.9 GiB)".
+func usageSummary(usage []managerUsage) string {
+	var total int64
+	var sizes []string
+	for _, u := range usage {
+		if u.Size > 0 {
+			total += u.Size
+			sizes = append(sizes, u.Manager+": "+humanSize(u.Size))
+		}
+	}
+	if len(sizes) == 0 {
+		return "The size of the installed packages is not known"
+	}
+	return "Installed size: " + humanSize(total) + " (" + strings.Join(sizes, ", ") + ")"
+}
+
+// usageChart draws a bar per manager, as long as its share of the largest:
+// "flatpak  ████████████    12.3 GiB  42 packages".
+func usageChart(usage []managerUsage, width int) []string {
+	colMgr := 6
+	for _, u := range usage {
+		colMgr = max(colMgr, ansi.StringWidth(u.Manager))
+	}
+	colSize := 10
+	colBar := max(width-colMgr-colSize-36, 10)
+
+	var largest int64
+	for _, u := range usage {
+		largest = max(largest, u.Size)
+	}
+	lines := make([]string, 0, len(usage))
+	for _, u := range usage {
+		n := 0
+		if largest > 0 {
+			n = int(math.Round(float64(colBar) * float64(u.Size) / float64(largest)))
+		}
+		if n == 0 && u.Size > 0 {
+			n = 1 // Too small to be seen next to the largest, but there
+		}
+		bar := strings.Repeat("█", n) + strings.Repeat(" ", colBar-n)
+		lines = append(lines, padRight(u.Manager, colMgr)+" "+bar+" "+padLeft(u.size(), colSize)+"  "+u.describe())
+	}
+	return lines
+}
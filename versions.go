@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// packageVersion is a version, channel or attribute a package can be
+// installed at, as offered in the version picker.
+type packageVersion struct {
+	Version string // e.g. "124.0-1", or the channel for snaps ("latest/beta")
+	Spec    string // what the Install template takes, e.g. "firefox=124.0-1"
+	Detail  string // where it comes from, e.g. the repository
+}
+
+// listVersions lists the versions of a package that its manager can install.
+func listVersions(ctx context.Context, r Runner, pkg Package) ([]packageVersion, error) {
+	var versions []packageVersion
+	switch key := managerKey(pkg.Manager); key {
+	case "apt":
+		out, err := r.Output(ctx, "apt-cache", "madison", pkg.Name)
+		if err != nil {
+			return nil, err
+		}
+		versions = parseAptCacheMadison(out)
+	case "dnf", "yum":
+		out, err := r.Output(ctx, key, "list", "--showduplicates", pkg.Name)
+		if err != nil {
+			return nil, err
+		}
+		versions = parseDnfListDuplicates(out, pkg.Name)
+	case "snap":
+		info, err := newSnapdClient(r).info(ctx, pkg.Name)
+		if err != nil {
+			return nil, err
+		}
+		versions = snapChannels(info)
+	case "brew":
+		out, err := r.Output(ctx, "brew", "info", "--json=v2", pkg.Name)
+		if err != nil {
+			return nil, err
+		}
+		versions = parseBrewVersions(out)
+	case "nix-env", "nix-profile":
+		out, err := r.Output(ctx, "nix", nixSearchArgs(pkg.Name)...)
+		if err != nil {
+			return nil, err
+		}
+		return parseNixSearchAttributes(out, pkg.Name), nil
+	default:
+		return nil, fmt.Errorf("choosing a version is not supported by %s", pkg.Manager)
+	}
+
+	for i, v := range versions {
+		if v.Spec == "" {
+			versions[i].Spec, _ = versionedName(pkg.Manager, pkg.Name, v.Version)
+		}
+	}
+	return versions, nil
+}
+
+// parseAptCacheMadison parses `apt-cache madison`: "name | version | source"
+// per line, newest first, with a line per source of a version.
+func parseAptCacheMadison(out []byte) []packageVersion {
+	var versions []packageVersion
+	seen := make(map[string]bool)
+	for _, line := range outputLines(out) {
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 {
+			continue
+		}
+		version := strings.TrimSpace(fields[1])
+		if version == "" || seen[version] {
+			continue
+		}
+		seen[version] = true
+		versions = append(versions, packageVersion{Version: version, Detail: strings.TrimSpace(fields[2])})
+	}
+	return versions
+}
+
+// parseDnfListDuplicates parses `dnf list --showduplicates name`:
+// "name.arch version repo" per line, under translated section headers.
+func parseDnfListDuplicates(out []byte, name string) []packageVersion {
+	var versions []packageVersion
+	seen := make(map[string]bool)
+	for _, line := range outputLines(out) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], name+".") {
+			continue
+		}
+		// Installed packages are listed with "@repo" or "<unknown>", and
+		// again under the repo they're available from
+		if seen[fields[1]] || strings.HasPrefix(fields[2], "@") || strings.HasPrefix(fields[2], "<") {
+			continue
+		}
+		seen[fields[1]] = true
+		versions = append(versions, packageVersion{Version: fields[1], Detail: fields[2]})
+	}
+	return versions
+}
+
+// snapRisks orders the channels of a track from the most stable.
+var snapRisks = map[string]int{"stable": 0, "candidate": 1, "beta": 2, "edge": 3}
+
+// snapChannels lists the channels of a snap, by track and risk.
+func snapChannels(info snapdSnap) []packageVersion {
+	names := make([]string, 0, len(info.Channels))
+	for name := range info.Channels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, ri, _ := strings.Cut(names[i], "/")
+		tj, rj, _ := strings.Cut(names[j], "/")
+		if ti != tj {
+			return ti == "latest" || (tj != "latest" && ti < tj)
+		}
+		return snapRisks[ri] < snapRisks[rj]
+	})
+
+	versions := make([]packageVersion, 0, len(names))
+	for _, name := range names {
+		ch := info.Channels[name]
+		detail := ch.Version
+		if ch.Confinement != "" && ch.Confinement != "strict" {
+			detail += " (" + ch.Confinement + ")"
+		}
+		versions = append(versions, packageVersion{Version: name, Spec: info.Name + " --channel=" + name, Detail: detail})
+	}
+	return versions
+}
+
+// parseBrewVersions parses `brew info --json=v2 name`: the current version,
+// then the versioned formulae (e.g. "python@3.11").
+func parseBrewVersions(out []byte) []packageVersion {
+	var info struct {
+		Formulae []struct {
+			Name     string `json:"name"`
+			Versions struct {
+				Stable string `json:"stable"`
+			} `json:"versions"`
+			VersionedFormulae []string `json:"versioned_formulae"`
+		} `json:"formulae"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil || len(info.Formulae) == 0 {
+		return nil
+	}
+	f := info.Formulae[0]
+	versions := []packageVersion{{Version: f.Versions.Stable, Spec: f.Name, Detail: "current"}}
+	for _, name := range f.VersionedFormulae {
+		if _, version, ok := strings.Cut(name, "@"); ok {
+			versions = append(versions, packageVersion{Version: version, Spec: name})
+		}
+	}
+	return versions
+}
+
+// nixSearchArgs searches nixpkgs for the attributes of a package, even where
+// flakes are not enabled (e.g. for nix-env users).
+func nixSearchArgs(name string) []string {
+	return []string{"--extra-experimental-features", "nix-command flakes", "search", "--json", "nixpkgs", name}
+}
+
+// parseNixSearchAttributes parses `nix search --json` into the attributes
+// of a package, e.g. nodejs_20 and nodejs_22 for nodejs. Their attribute
+// name is what the templates take. The search also matches descriptions,
+// so other packages are left out.
+func parseNixSearchAttributes(out []byte, name string) []packageVersion {
+	var found map[string]struct {
+		Pname   string `json:"pname"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(out, &found); err != nil {
+		return nil
+	}
+	var versions []packageVersion
+	for path, p := range found {
+		if p.Pname != name {
+			continue
+		}
+		// "legacyPackages.x86_64-linux.nodejs_20"
+		parts := strings.SplitN(path, ".", 3)
+		attr := parts[len(parts)-1]
+		versions = append(versions, packageVersion{Version: p.Version, Spec: attr, Detail: attr})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Spec < versions[j].Spec })
+	return versions
+}
+
+// versionsMsg carries the versions listed for the version picker.
+type versionsMsg struct {
+	pkg      Package
+	versions []packageVersion
+	err      error
+}
+
+func loadVersions(r Runner, pkg Package) tea.Cmd {
+	return func() tea.Msg {
+		versions, err := listVersions(context.Background(), r, pkg)
+		return versionsMsg{pkg: pkg, versions: versions, err: err}
+	}
+}
+
+// versionPicker lists the versions of a package to install one of them.
+type versionPicker struct {
+	pkg      Package
+	versions []packageVersion
+	cursor   int
+}
+
+// versionJob installs a package at the chosen version. Installed snaps are
+// switched to the channel by refreshing them.
+func versionJob(r Runner, pkg Package, v packageVersion) tea.Cmd {
+	cmds := pm_commands[managerKey(pkg.Manager)]
+	action, template := "install", cmds.Install
+	if managerKey(pkg.Manager) == "snap" {
+		if pkg.IsInstalled {
+			action = "upgrade"
+		}
+		return snapConfinementJob(r, action, pkg, v.Version)
+	}
+	return runJob(r, action, template, pkg, v.Spec)
+}